@@ -15,6 +15,78 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/audit": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Returns the forge audit history of a Widget, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Audit Endpoint",
+                "operationId": "audit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Widget kind (i.e. Button)",
+                        "name": "kind",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "widgets.templates.krateo.io",
+                        "description": "Widget API group",
+                        "name": "group",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/audit.Entry"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    }
+                }
+            }
+        },
         "/forge": {
             "get": {
                 "security": [
@@ -24,7 +96,8 @@ const docTemplate = `{
                 ],
                 "description": "Generate a CRD from a JSON Schema",
                 "produces": [
-                    "text/plain"
+                    "text/plain",
+                    "application/json"
                 ],
                 "summary": "Generate a CRD from a JSON Schema",
                 "operationId": "forge",
@@ -49,13 +122,43 @@ const docTemplate = `{
                         "name": "apply",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait for the applied CRD to be established and return its conditions",
+                        "name": "wait",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "How long to wait for the CRD to be established (default 30s)",
+                        "name": "timeout",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "CRD YAML",
+                        "description": "CRD conditions (when wait=true)",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handlers.forgeResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
                         }
                     }
                 }
@@ -92,13 +195,27 @@ const docTemplate = `{
                 ],
                 "summary": "List Endpoint",
                 "operationId": "list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag of the cached copy",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.info"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.info"
+                            }
                         }
                     },
+                    "304": {
+                        "description": "Not Modified"
+                    },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
@@ -111,6 +228,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/response.Status"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -126,40 +249,382 @@ const docTemplate = `{
                 }
             }
         },
-        "/schema": {
+        "/readyz": {
+            "get": {
+                "description": "Checks the service dependencies: API server reachability, access to apiextensions,\nauthn clientconfig secrets namespace and JWT signing key configuration",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Readiness Endpoint",
+                "operationId": "readyz",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.readyzResult"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.readyzResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/revisions": {
             "get": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "CRD OpenAPI Schema",
+                "description": "Returns the input schema revisions of a Widget, oldest first,\nor the JSON Schema of one revision when 'revision' is specified",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Fetch CRD OpenAPI Schema",
-                "operationId": "schema",
+                "summary": "Schema Revisions Endpoint",
+                "operationId": "revisions",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "API Version",
-                        "name": "version",
+                        "description": "Widget kind (i.e. Button)",
+                        "name": "kind",
                         "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Resource name",
-                        "name": "resource",
+                        "default": "widgets.templates.krateo.io",
+                        "description": "Widget API group",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Revision number",
+                        "name": "revision",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/revisions.Revision"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    }
+                }
+            }
+        },
+        "/revisions/rollback": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Forges, and applies, the CRD again from a stored input schema revision.\nThe response is the same of /forge.",
+                "produces": [
+                    "text/plain",
+                    "application/json"
+                ],
+                "summary": "Rollback Endpoint",
+                "operationId": "rollback",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Widget kind (i.e. Button)",
+                        "name": "kind",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "widgets.templates.krateo.io",
+                        "description": "Widget API group",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Revision number",
+                        "name": "revision",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait for the applied CRD to be established and return its conditions",
+                        "name": "wait",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "How long to wait for the CRD to be established (default 30s)",
+                        "name": "timeout",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CRD conditions (when wait=true)",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.forgeResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    }
+                }
+            }
+        },
+        "/schema": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "CRD OpenAPI Schema. Without 'version' all the served versions are returned, keyed by version name.\nWith many resources (or bulk=true) the schemas are resolved concurrently and returned as a list, each item with its own error.",
+                "produces": [
+                    "application/json",
+                    "application/yaml"
+                ],
+                "summary": "Fetch CRD OpenAPI Schema",
+                "operationId": "schema",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Version (all served versions when missing)",
+                        "name": "version",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "API Version with group (i.e. widgets.templates.krateo.io/v1beta1), alternative to version",
+                        "name": "apiVersion",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Resource name (repeat it, or separate names by comma, for the bulk mode)",
+                        "name": "resource",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Kind (i.e. Button), alternative to resource",
+                        "name": "kind",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Reply with a list of items even for a single resource",
+                        "name": "bulk",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sub-schema JSON Pointer (/properties/spec/properties/widgetData) or dotted field path (spec.widgetData)",
+                        "name": "path",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "openapi",
+                            "jsonschema",
+                            "openapi3"
+                        ],
+                        "type": "string",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cached copy",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "bulk mode",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.schemaItem"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    }
+                }
+            }
+        },
+        "/watch": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Streams Server-Sent Events when widget CRDs are added, updated or deleted.\nEach event carries the same payload as a /list item; the event id is the\nCRD resourceVersion and can be sent back as Last-Event-ID to resume.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Watch Endpoint",
+                "operationId": "watch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "resourceVersion to resume from",
+                        "name": "Last-Event-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/handlers.info"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/response.Status"
                         }
                     }
                 }
@@ -167,6 +632,98 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "audit.Entry": {
+            "type": "object",
+            "properties": {
+                "crd": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "schemaHash": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "traceId": {
+                    "type": "string"
+                },
+                "user": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "crds.Condition": {
+            "type": "object",
+            "properties": {
+                "lastTransitionTime": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.checkResult": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.forgeResult": {
+            "type": "object",
+            "properties": {
+                "conditions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/crds.Condition"
+                    }
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
         "handlers.info": {
             "type": "object",
             "properties": {
@@ -187,6 +744,38 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.readyzResult": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.checkResult"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.schemaItem": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/response.Status"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "resource": {
+                    "type": "string"
+                },
+                "schema": {},
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
         "handlers.serviceInfo": {
             "type": "object",
             "properties": {
@@ -249,6 +838,7 @@ const docTemplate = `{
                 "NotAcceptable",
                 "RequestEntityTooLarge",
                 "UnsupportedMediaType",
+                "UnprocessableEntity",
                 "InternalError",
                 "ServiceUnavailable"
             ],
@@ -267,9 +857,39 @@ const docTemplate = `{
                 "StatusReasonNotAcceptable",
                 "StatusReasonRequestEntityTooLarge",
                 "StatusReasonUnsupportedMediaType",
+                "StatusUnprocessableEntity",
                 "StatusReasonInternalError",
                 "StatusReasonServiceUnavailable"
             ]
+        },
+        "revisions.Revision": {
+            "type": "object",
+            "properties": {
+                "configMap": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "schemaHash": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "user": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
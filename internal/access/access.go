@@ -0,0 +1,61 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+type Result struct {
+	Allowed bool
+	Reason  string
+}
+
+// Review asks the API server, with the credentials in rc, whether
+// the owner of those credentials can perform the specified action.
+func Review(ctx context.Context, rc *rest.Config, attrs authorizationv1.ResourceAttributes) (Result, error) {
+	cs, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		return Result{}, err
+	}
+
+	sar, err := cs.AuthorizationV1().SelfSubjectAccessReviews().
+		Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &attrs,
+			},
+		}, metav1.CreateOptions{})
+	if err != nil {
+		return Result{}, fmt.Errorf("unable to review access: %w", err)
+	}
+
+	return Result{
+		Allowed: sar.Status.Allowed && !sar.Status.Denied,
+		Reason:  sar.Status.Reason,
+	}, nil
+}
+
+// Describe returns a kubectl-like description of the action,
+// suitable for error messages (e.g. 'get customresourcedefinitions.apiextensions.k8s.io "foo"').
+func Describe(attrs authorizationv1.ResourceAttributes) string {
+	var sb strings.Builder
+	sb.WriteString(attrs.Verb)
+	sb.WriteString(" ")
+	sb.WriteString(attrs.Resource)
+	if len(attrs.Group) > 0 {
+		sb.WriteString(".")
+		sb.WriteString(attrs.Group)
+	}
+	if len(attrs.Name) > 0 {
+		fmt.Fprintf(&sb, " %q", attrs.Name)
+	}
+	if len(attrs.Namespace) > 0 {
+		fmt.Fprintf(&sb, " in namespace %q", attrs.Namespace)
+	}
+	return sb.String()
+}
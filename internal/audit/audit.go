@@ -0,0 +1,231 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/kubeutil"
+	"github.com/krateoplatformops/plumbing/kubeutil/eventrecorder"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	LabelAudit = "smithery.krateo.io/audit"
+	LabelGroup = "smithery.krateo.io/group"
+	LabelKind  = "smithery.krateo.io/kind"
+
+	entryKey     = "entry.json"
+	recorderName = "smithery"
+
+	// DefaultMaxEntries is the default number of entries kept for each widget.
+	DefaultMaxEntries = 100
+)
+
+// Outcome is the result of an audited forge.
+type Outcome string
+
+const (
+	OutcomeSuccess          Outcome = "success"
+	OutcomeGenerateError    Outcome = "generate_error"
+	OutcomeApplyError       Outcome = "apply_error"
+	OutcomeNamesNotAccepted Outcome = "names_not_accepted"
+	OutcomeTimeout          Outcome = "timeout"
+	OutcomeNotEstablished   Outcome = "not_established"
+)
+
+// Entry is a single forge audit record.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Group      string    `json:"group"`
+	Kind       string    `json:"kind"`
+	Version    string    `json:"version"`
+	CRD        string    `json:"crd,omitempty"`
+	SchemaHash string    `json:"schemaHash"`
+	Outcome    Outcome   `json:"outcome"`
+	Message    string    `json:"message,omitempty"`
+	TraceId    string    `json:"traceId,omitempty"`
+}
+
+// Succeeded reports whether the audited forge succeeded.
+func (e *Entry) Succeeded() bool {
+	return e.Outcome == OutcomeSuccess
+}
+
+// SchemaHash returns the hash recorded for an input schema.
+func SchemaHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Recorder stores the audit entries as immutable (append-only) ConfigMaps
+// in its namespace and as Kubernetes Events on the forged CRDs. Only the
+// newest maxEntries entries of each widget are kept, all of them when
+// maxEntries is not positive.
+type Recorder struct {
+	client     kubernetes.Interface
+	events     events.EventRecorder
+	namespace  string
+	maxEntries int
+}
+
+func NewRecorder(ctx context.Context, rc *rest.Config, namespace string, maxEntries int) (*Recorder, error) {
+	cs, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := eventrecorder.Create(ctx, rc, recorderName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRecorder(cs, rec, namespace, maxEntries), nil
+}
+
+func newRecorder(cs kubernetes.Interface, rec events.EventRecorder, namespace string, maxEntries int) *Recorder {
+	return &Recorder{
+		client:     cs,
+		events:     rec,
+		namespace:  namespace,
+		maxEntries: maxEntries,
+	}
+}
+
+// Record stores the entry; when crd is not nil an Event is emitted on it too.
+func (r *Recorder) Record(ctx context.Context, e Entry, crd runtime.Object) error {
+	if r == nil {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	if crd != nil {
+		if e.Succeeded() {
+			r.events.Eventf(crd, nil, corev1.EventTypeNormal, "Forged", "Forge",
+				"CRD forged by %s (schema %s, trace %s)", e.User, e.SchemaHash, e.TraceId)
+		} else {
+			r.events.Eventf(crd, nil, corev1.EventTypeWarning, "ForgeFailed", "Forge",
+				"CRD forge by %s failed with %s (schema %s, trace %s): %s", e.User, e.Outcome, e.SchemaHash, e.TraceId, e.Message)
+		}
+	}
+
+	dat, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.CoreV1().ConfigMaps(r.namespace).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("smithery-audit-%s-%s",
+				kubeutil.MakeDNS1123Compatible(e.Kind), rand.String(10)),
+			Namespace: r.namespace,
+			Labels: map[string]string{
+				LabelAudit: "true",
+				LabelGroup: e.Group,
+				LabelKind:  e.Kind,
+			},
+		},
+		Immutable: ptr.To(true),
+		Data: map[string]string{
+			entryKey: string(dat),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to store audit entry: %w", err)
+	}
+
+	if err := r.prune(ctx, e.Group, e.Kind); err != nil {
+		return fmt.Errorf("unable to prune audit entries: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the audit history of a widget, oldest first.
+func (r *Recorder) List(ctx context.Context, group, kind string) ([]Entry, error) {
+	all, err := r.list(ctx, group, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Entry, 0, len(all))
+	for _, el := range all {
+		res = append(res, el.entry)
+	}
+
+	return res, nil
+}
+
+// prune deletes the oldest entries of a widget beyond maxEntries.
+func (r *Recorder) prune(ctx context.Context, group, kind string) error {
+	if r.maxEntries <= 0 {
+		return nil
+	}
+
+	all, err := r.list(ctx, group, kind)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range all[:max(len(all)-r.maxEntries, 0)] {
+		err := r.client.CoreV1().ConfigMaps(r.namespace).Delete(ctx, el.name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type storedEntry struct {
+	name  string
+	entry Entry
+}
+
+// list returns the stored entries of a widget, oldest first.
+func (r *Recorder) list(ctx context.Context, group, kind string) ([]storedEntry, error) {
+	sel := labels.SelectorFromSet(labels.Set{
+		LabelAudit: "true",
+		LabelGroup: group,
+		LabelKind:  kind,
+	})
+
+	all, err := r.client.CoreV1().ConfigMaps(r.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: sel.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]storedEntry, 0, len(all.Items))
+	for _, el := range all.Items {
+		var e Entry
+		if err := json.Unmarshal([]byte(el.Data[entryKey]), &e); err != nil {
+			continue
+		}
+		res = append(res, storedEntry{name: el.Name, entry: e})
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].entry.Time.Before(res[j].entry.Time)
+	})
+
+	return res, nil
+}
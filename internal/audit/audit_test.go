@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/events"
+)
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	cs := fake.NewClientset()
+	ev := events.NewFakeRecorder(10)
+	rec := newRecorder(cs, ev, "demo-system", DefaultMaxEntries)
+
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName("buttons.widgets.templates.krateo.io")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []Entry{
+		{
+			Time: now.Add(time.Minute), User: "cyberjoker", Group: "widgets.templates.krateo.io",
+			Kind: "Button", Version: "v1beta1", SchemaHash: SchemaHash([]byte("{}")),
+			Outcome: OutcomeNamesNotAccepted, Message: "names not accepted", TraceId: "abc",
+		},
+		{
+			Time: now, User: "cyberjoker", Group: "widgets.templates.krateo.io",
+			Kind: "Button", Version: "v1beta1", SchemaHash: SchemaHash([]byte("{}")),
+			Outcome: OutcomeSuccess, TraceId: "def",
+		},
+		{
+			Time: now, User: "cyberjoker", Group: "widgets.templates.krateo.io",
+			Kind: "Panel", Version: "v1beta1", Outcome: OutcomeSuccess,
+		},
+	}
+
+	for _, el := range entries {
+		require.NoError(t, rec.Record(ctx, el, crd))
+	}
+
+	all, err := cs.CoreV1().ConfigMaps("demo-system").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, all.Items, 3)
+	for _, el := range all.Items {
+		assert.True(t, *el.Immutable)
+	}
+
+	assert.Contains(t, <-ev.Events, "Warning ForgeFailed")
+	assert.Contains(t, <-ev.Events, "Normal Forged")
+
+	got, err := rec.List(ctx, "widgets.templates.krateo.io", "Button")
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "def", got[0].TraceId, "oldest first")
+	assert.Equal(t, "abc", got[1].TraceId)
+	assert.True(t, strings.HasPrefix(got[0].SchemaHash, "sha256:"))
+
+	var nilRecorder *Recorder
+	assert.NoError(t, nilRecorder.Record(ctx, entries[0], crd))
+}
+
+func TestRecorderPrune(t *testing.T) {
+	ctx := context.Background()
+
+	cs := fake.NewClientset()
+	rec := newRecorder(cs, events.NewFakeRecorder(10), "demo-system", 2)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := range 4 {
+		require.NoError(t, rec.Record(ctx, Entry{
+			Time: now.Add(time.Duration(i) * time.Minute), User: "cyberjoker",
+			Group: "widgets.templates.krateo.io", Kind: "Button",
+			Outcome: OutcomeSuccess, TraceId: fmt.Sprintf("t%d", i),
+		}, nil))
+	}
+	require.NoError(t, rec.Record(ctx, Entry{
+		Time: now, Group: "widgets.templates.krateo.io", Kind: "Panel", Outcome: OutcomeSuccess,
+	}, nil))
+
+	got, err := rec.List(ctx, "widgets.templates.krateo.io", "Button")
+	require.NoError(t, err)
+	require.Len(t, got, 2, "only the newest entries are kept")
+	assert.Equal(t, "t2", got[0].TraceId)
+	assert.Equal(t, "t3", got[1].TraceId)
+
+	got, err = rec.List(ctx, "widgets.templates.krateo.io", "Panel")
+	require.NoError(t, err)
+	assert.Len(t, got, 1, "entries are pruned by widget")
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand of the smithery binary.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{name: "forge", summary: "generate widget CRDs from JSON Schemas, offline", run: runForge},
+	{name: "validate", summary: "validate widget custom resources against CRD files, offline", run: runValidate},
+}
+
+// IsCommand reports whether name is a CLI subcommand; when it is
+// not the binary runs the HTTP server.
+func IsCommand(name string) bool {
+	_, ok := lookup(name)
+	return ok
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := lookup(args[0])
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	err := cmd.run(args[1:], stdout, stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "smithery %s: %v\n", cmd.name, err)
+		return 1
+	}
+}
+
+// errUsage is returned by the commands when the arguments are invalid
+// and the usage has already been printed.
+var errUsage = errors.New("invalid usage")
+
+func lookup(name string) (command, bool) {
+	for _, el := range commands {
+		if el.name == name {
+			return el, true
+		}
+	}
+	return command{}, false
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: smithery [flags] | smithery <command> [flags]")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, el := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", el.name, el.summary)
+	}
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(val string) error {
+	*f = append(*f, val)
+	return nil
+}
+
+// expandInputs expands the glob patterns (and directories, to the files with one of
+// the given extensions they contain) into a sorted list of files without duplicates.
+func expandInputs(patterns []string, exts ...string) ([]string, error) {
+	seen := map[string]bool{}
+	res := []string{}
+
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			res = append(res, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		all, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(all) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+
+		for _, path := range all {
+			files, err := filesIn(path, exts)
+			if err != nil {
+				return nil, err
+			}
+			for _, el := range files {
+				add(el)
+			}
+		}
+	}
+
+	sort.Strings(res)
+	return res, nil
+}
+
+// filesIn returns path itself when it is a file, or the files
+// with one of the given extensions when it is a directory.
+func filesIn(path string, exts []string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for _, el := range entries {
+		if el.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(el.Name()))
+		for _, want := range exts {
+			if ext == want {
+				res = append(res, filepath.Join(path, el.Name()))
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/krateoplatformops/smithery/internal/forge"
+	"sigs.k8s.io/yaml"
+)
+
+const forgeUsage = `Usage: smithery forge -f <schema.json|glob|dir> [-f ...] [-o <crd.yaml|dir/>] [flags]
+
+Generates the widget CRDs from their JSON Schemas, without a cluster.
+
+With many inputs and an output directory (an existing one, or a path ending
+with '/'), each CRD is written in '<group>_<plural>.yaml'; otherwise all the
+CRDs are written, as a multi-document YAML, to the output file or to stdout.
+
+Allowed resources selectors ('x-krateo-allowed-resources') need the API discovery:
+offline their CRDs accept any resource, until refreshed by a running Smithery.
+
+Examples:
+  smithery forge -f button.json -o crd.yaml
+  smithery forge -f 'widgets/*.json' -o crds/
+
+Flags:
+`
+
+func runForge(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("forge", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, forgeUsage)
+		fs.PrintDefaults()
+	}
+
+	var inputs stringsFlag
+	fs.Var(&inputs, "f", "widget JSON Schema file, glob pattern or directory (repeatable)")
+	output := fs.String("o", "-", "output file or directory ('-' for stdout)")
+	group := fs.String("group", forge.DefaultGroup, "API group of the generated CRDs")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Files expanded by the shell (i.e. -f widgets/*.json) are positional arguments.
+	inputs = append(inputs, fs.Args()...)
+	if len(inputs) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	files, err := expandInputs(inputs, ".json")
+	if err != nil {
+		return err
+	}
+
+	toDir := isDir(*output)
+	if toDir {
+		if err := os.MkdirAll(*output, 0o755); err != nil {
+			return err
+		}
+	}
+
+	var (
+		all    bytes.Buffer
+		failed int
+	)
+	for _, src := range files {
+		crd, plural, err := forgeFile(src, *group)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", src, err)
+			failed++
+			continue
+		}
+
+		if !toDir {
+			if all.Len() > 0 && !bytes.HasPrefix(crd, []byte("---")) {
+				all.WriteString("---\n")
+			}
+			all.Write(crd)
+			continue
+		}
+
+		dst := filepath.Join(*output, fmt.Sprintf("%s_%s.yaml", *group, plural))
+		if err := os.WriteFile(dst, crd, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "%s -> %s\n", src, dst)
+	}
+
+	if !toDir && all.Len() > 0 {
+		if err := writeOutput(*output, all.Bytes(), stdout); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d schemas not forged", failed, len(files))
+	}
+
+	return nil
+}
+
+// forgeFile returns the CRD generated from a widget JSON Schema file and its plural name.
+func forgeFile(path, group string) ([]byte, string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	w, err := forge.ParseJSON(dat)
+	if err != nil {
+		return nil, "", err
+	}
+
+	crd, err := forge.Generate(group, w)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to generate CRD: %w", err)
+	}
+
+	var names struct {
+		Spec struct {
+			Names struct {
+				Plural string `json:"plural"`
+			} `json:"names"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(crd, &names); err != nil {
+		return nil, "", fmt.Errorf("unable to read generated CRD names: %w", err)
+	}
+
+	return crd, names.Spec.Names.Plural, nil
+}
+
+func writeOutput(path string, data []byte, stdout io.Writer) error {
+	if path == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// isDir reports whether the output path is a directory: an existing
+// one or a path ending with a separator.
+func isDir(path string) bool {
+	if path == "-" {
+		return false
+	}
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const buttonSchema = "../../testdata/widgets.templates.krateo.io_buttons.json"
+
+func TestForgeCommand(t *testing.T) {
+	button, err := os.ReadFile(buttonSchema)
+	require.NoError(t, err)
+
+	panel := strings.ReplaceAll(string(button), "Button", "Panel")
+
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "button.json"), button, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "panel.json"), []byte(panel), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "broken.json"), []byte(`{"type":"object"}`), 0o644))
+
+	t.Run("single file to stdout", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"forge", "-f", buttonSchema}, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+		assert.Contains(t, stdout.String(), "name: buttons.widgets.templates.krateo.io")
+	})
+
+	t.Run("single file to file", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "out", "crd.yaml")
+
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"forge", "-f", buttonSchema, "-o", dst}, &stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+		assert.Empty(t, stdout.String())
+
+		dat, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Contains(t, string(dat), "kind: CustomResourceDefinition")
+	})
+
+	t.Run("glob to directory", func(t *testing.T) {
+		dst := t.TempDir() + "/crds/"
+
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"forge", "-f", filepath.Join(src, "*.json"), "-o", dst}, &stdout, &stderr)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr.String(), "broken.json: unable to extract kind and version")
+		assert.Contains(t, stderr.String(), "1 of 3 schemas not forged")
+
+		for _, name := range []string{
+			"widgets.templates.krateo.io_buttons.yaml",
+			"widgets.templates.krateo.io_panels.yaml",
+		} {
+			assert.FileExists(t, filepath.Join(dst, name))
+		}
+	})
+
+	t.Run("files expanded by the shell", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"forge", "-f", filepath.Join(src, "button.json"), filepath.Join(src, "panel.json")},
+			&stdout, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, 2, strings.Count(stdout.String(), "kind: CustomResourceDefinition"))
+		assert.Equal(t, 2, strings.Count(stdout.String(), "---\n"))
+	})
+
+	t.Run("no inputs", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, Run([]string{"forge"}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "Usage: smithery forge")
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, Run([]string{"forge", "-f", filepath.Join(src, "*.yaml")}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "no files match")
+	})
+}
+
+func TestIsCommand(t *testing.T) {
+	assert.True(t, IsCommand("forge"))
+	assert.False(t, IsCommand("-port"))
+	assert.False(t, IsCommand("serve"))
+}
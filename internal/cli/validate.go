@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/crds/schema"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	"github.com/krateoplatformops/smithery/internal/widgets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const validateUsage = `Usage: smithery validate --crd <crd.yaml|glob|dir> [--crd ...] -f <cr.yaml|glob|dir> [-f ...] [flags]
+
+Validates widget custom resources against the schemas of their CRDs, without a cluster.
+The exit code is 1 when at least a custom resource is invalid.
+
+Examples:
+  smithery validate --crd crds/ -f 'widgets/*.yaml'
+  smithery validate --crd crds/ -f widgets/ --output junit > report.xml
+
+Flags:
+`
+
+// Validate output formats.
+const (
+	formatJSON  = "json"
+	formatJUnit = "junit"
+)
+
+var errInvalid = errors.New("invalid custom resources found")
+
+// validateResult is the validation outcome of a custom resource.
+type validateResult struct {
+	File       string       `json:"file"`
+	Document   int          `json:"document"`
+	APIVersion string       `json:"apiVersion,omitempty"`
+	Kind       string       `json:"kind,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	Valid      bool         `json:"valid"`
+	Errors     []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field  string `json:"field,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Detail string `json:"detail"`
+}
+
+type validateReport struct {
+	Total   int              `json:"total"`
+	Valid   int              `json:"valid"`
+	Invalid int              `json:"invalid"`
+	Results []validateResult `json:"results"`
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, validateUsage)
+		fs.PrintDefaults()
+	}
+
+	var crdInputs, inputs stringsFlag
+	fs.Var(&crdInputs, "crd", "CRD file, glob pattern or directory (repeatable)")
+	fs.Var(&inputs, "f", "custom resource file, glob pattern or directory (repeatable)")
+	format := fs.String("output", formatJSON, "report format: json or junit")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Files expanded by the shell (i.e. -f widgets/*.yaml) are positional arguments.
+	inputs = append(inputs, fs.Args()...)
+	if len(crdInputs) == 0 || len(inputs) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if *format != formatJSON && *format != formatJUnit {
+		return fmt.Errorf("unknown output format %q, must be one of: %s, %s", *format, formatJSON, formatJUnit)
+	}
+
+	defs, err := loadCRDs(crdInputs)
+	if err != nil {
+		return err
+	}
+
+	files, err := expandInputs(inputs, ".yaml", ".yml", ".json")
+	if err != nil {
+		return err
+	}
+
+	report := validateReport{Results: []validateResult{}}
+	for _, path := range files {
+		docs, err := readDocuments(path)
+		if err != nil {
+			report.add(validateResult{File: path, Errors: []fieldError{{Detail: err.Error()}}})
+			continue
+		}
+
+		for i, obj := range docs {
+			res := validateDocument(defs, obj)
+			res.File, res.Document = path, i
+			report.add(res)
+		}
+	}
+
+	if *format == formatJUnit {
+		err = writeJUnit(stdout, &report)
+	} else {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(&report)
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.Invalid > 0 {
+		return errInvalid
+	}
+
+	return nil
+}
+
+func (r *validateReport) add(res validateResult) {
+	r.Total++
+	if res.Valid {
+		r.Valid++
+	} else {
+		r.Invalid++
+	}
+	r.Results = append(r.Results, res)
+}
+
+// validateDocument validates a custom resource against its CRD, found by group and kind.
+func validateDocument(defs map[string]map[string]any, obj map[string]any) validateResult {
+	gv := dynamic.GroupVersion(obj)
+	res := validateResult{
+		APIVersion: gv.String(),
+		Kind:       dynamic.GetKind(obj),
+		Name:       dynamic.GetName(obj),
+	}
+
+	if len(res.Kind) == 0 || len(gv.Version) == 0 {
+		res.Errors = []fieldError{{Detail: "apiVersion and kind are required"}}
+		return res
+	}
+
+	crd, ok := defs[crdKey(gv.Group, res.Kind)]
+	if !ok {
+		res.Errors = []fieldError{{Detail: fmt.Sprintf("no CRD found for kind %q in group %q", res.Kind, gv.Group)}}
+		return res
+	}
+
+	errs, err := schema.ValidateCustomResource(crd, obj)
+	if err != nil {
+		res.Errors = []fieldError{{Detail: err.Error()}}
+		return res
+	}
+
+	// Krateo semantics (forPath targets, JQ expressions, resourcesRefs ids).
+	if sch, err := crds.OpenAPISchema(crd, gv.Version); err == nil {
+		errs = append(errs, widgets.Validate(obj, sch)...)
+	}
+
+	res.Valid = len(errs) == 0
+	res.Errors = toFieldErrors(errs)
+	return res
+}
+
+func toFieldErrors(errs field.ErrorList) []fieldError {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	res := make([]fieldError, 0, len(errs))
+	for _, el := range errs {
+		res = append(res, fieldError{
+			Field:  el.Field,
+			Type:   string(el.Type),
+			Detail: el.ErrorBody(),
+		})
+	}
+	return res
+}
+
+// loadCRDs reads the CRDs, indexed by group and kind, skipping any other document.
+func loadCRDs(patterns []string) (map[string]map[string]any, error) {
+	files, err := expandInputs(patterns, ".yaml", ".yml", ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]map[string]any{}
+	for _, path := range files {
+		docs, err := readDocuments(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, el := range docs {
+			if dynamic.GetKind(el) != "CustomResourceDefinition" {
+				continue
+			}
+
+			spec, _ := el["spec"].(map[string]any)
+			group, _ := spec["group"].(string)
+			names, _ := spec["names"].(map[string]any)
+			kind, _ := names["kind"].(string)
+			if len(group) == 0 || len(kind) == 0 {
+				return nil, fmt.Errorf("%s: CRD %q without spec.group or spec.names.kind", path, dynamic.GetName(el))
+			}
+
+			res[crdKey(group, kind)] = el
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no CRDs found in %s", strings.Join(patterns, ", "))
+	}
+
+	return res, nil
+}
+
+func crdKey(group, kind string) string {
+	return kind + "." + group
+}
+
+// readDocuments decodes all the (YAML or JSON) documents of a file, skipping the empty ones.
+func readDocuments(path string) ([]map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := k8syaml.NewYAMLOrJSONDecoder(f, 4096)
+
+	res := []map[string]any{}
+	for {
+		obj := map[string]any{}
+		err := dec.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(obj) > 0 {
+			res = append(res, obj)
+		}
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the report as a JUnit XML document, with a test suite
+// for each file and a test case for each custom resource.
+func writeJUnit(out io.Writer, r *validateReport) error {
+	doc := junitTestSuites{Tests: r.Total, Failures: r.Invalid}
+
+	idx := map[string]int{}
+	for _, res := range r.Results {
+		i, ok := idx[res.File]
+		if !ok {
+			i = len(doc.Suites)
+			idx[res.File] = i
+			doc.Suites = append(doc.Suites, junitSuite{Name: res.File})
+		}
+
+		tc := junitTestCase{
+			ClassName: res.File,
+			Name:      fmt.Sprintf("%s/%s#%d", res.Kind, res.Name, res.Document),
+		}
+		if !res.Valid {
+			lines := make([]string, 0, len(res.Errors))
+			for _, el := range res.Errors {
+				if len(el.Field) > 0 {
+					lines = append(lines, el.Field+": "+el.Detail)
+				} else {
+					lines = append(lines, el.Detail)
+				}
+			}
+
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d validation errors", len(res.Errors)),
+				Type:    "ValidationError",
+				Text:    strings.Join(lines, "\n"),
+			}
+			doc.Suites[i].Failures++
+		}
+
+		doc.Suites[i].Tests++
+		doc.Suites[i].TestCases = append(doc.Suites[i].TestCases, tc)
+	}
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(out, "\n")
+	return err
+}
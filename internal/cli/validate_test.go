@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const customResources = `apiVersion: widgets.templates.krateo.io/v1beta1
+kind: Button
+metadata:
+  name: ok
+spec:
+  widgetData:
+    label: Click me
+    clickActionId: go
+    actions: {}
+status: {}
+---
+apiVersion: widgets.templates.krateo.io/v1beta1
+kind: Button
+metadata:
+  name: ko
+spec:
+  widgetData:
+    label: 42
+    actions: {}
+  widgetDataTemplate:
+  - forPath: label
+    expression: ${ .name | ascii_downcas }
+status: {}
+---
+apiVersion: widgets.templates.krateo.io/v1beta1
+kind: Panel
+metadata:
+  name: unknown
+`
+
+func TestValidateCommand(t *testing.T) {
+	crds := filepath.Join(t.TempDir(), "crds") + "/"
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, Run([]string{"forge", "-f", buttonSchema, "-o", crds}, &stdout, &stderr), stderr.String())
+
+	src := filepath.Join(t.TempDir(), "widgets.yaml")
+	require.NoError(t, os.WriteFile(src, []byte(customResources), 0o644))
+
+	t.Run("json report", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"validate", "--crd", crds, "-f", src}, &stdout, &stderr)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr.String(), "invalid custom resources found")
+
+		var report validateReport
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+		assert.Equal(t, 3, report.Total)
+		assert.Equal(t, 1, report.Valid)
+		assert.Equal(t, 2, report.Invalid)
+		require.Len(t, report.Results, 3)
+
+		assert.True(t, report.Results[0].Valid)
+		assert.Equal(t, "ok", report.Results[0].Name)
+
+		ko := report.Results[1]
+		assert.False(t, ko.Valid)
+		fields := []string{}
+		for _, el := range ko.Errors {
+			fields = append(fields, el.Field)
+		}
+		assert.ElementsMatch(t, []string{
+			"spec.widgetData.label",
+			"spec.widgetData.clickActionId",
+			"spec.widgetDataTemplate[0].expression",
+		}, fields)
+
+		assert.Contains(t, report.Results[2].Errors[0].Detail, `no CRD found for kind "Panel"`)
+	})
+
+	t.Run("junit report", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"validate", "--crd", crds, "--output", "junit", src}, &stdout, &stderr)
+		assert.Equal(t, 1, code)
+
+		var doc junitTestSuites
+		require.NoError(t, xml.Unmarshal(stdout.Bytes(), &doc))
+		assert.Equal(t, 3, doc.Tests)
+		assert.Equal(t, 2, doc.Failures)
+		require.Len(t, doc.Suites, 1)
+		require.Len(t, doc.Suites[0].TestCases, 3)
+		assert.Nil(t, doc.Suites[0].TestCases[0].Failure)
+		assert.Equal(t, "Button/ko#1", doc.Suites[0].TestCases[1].Name)
+		assert.Contains(t, doc.Suites[0].TestCases[1].Failure.Text, "spec.widgetData.label")
+	})
+
+	t.Run("missing flags", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, Run([]string{"validate", "-f", src}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "Usage: smithery validate")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, Run([]string{"validate", "--crd", crds, "--output", "tap", src}, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), `unknown output format "tap"`)
+	})
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	uclient "github.com/krateoplatformops/smithery/internal/dynamic"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Controller reconciles the WidgetDefinitions every time they, or the CRDs
+// they own, change.
+type Controller struct {
+	reconciler *Reconciler
+	log        *slog.Logger
+	queue      workqueue.TypedRateLimitingInterface[string]
+	informers  []cache.SharedIndexInformer
+}
+
+func New(rc *rest.Config, group string, log *slog.Logger) (*Controller, error) {
+	dc, err := dynamic.NewForConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newController(dc, group, log)
+	if err != nil {
+		return nil, err
+	}
+
+	uc, err := uclient.NewClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	c.reconciler.discover = func(ctx context.Context, category, group string) ([]schema.GroupVersionResource, error) {
+		// Widgets forged since the last reconcile must be discovered.
+		uc.ResetMapper()
+		return uc.DiscoverResources(ctx, category, group)
+	}
+
+	return c, nil
+}
+
+func newController(dc dynamic.Interface, group string, log *slog.Logger) (*Controller, error) {
+	c := &Controller{
+		reconciler: NewReconciler(dc, group),
+		log:        log.With(slog.String("controller", Resource)),
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: Resource}),
+	}
+
+	defs := dynamicinformer.NewDynamicSharedInformerFactory(dc, 10*time.Minute).
+		ForResource(GVR).Informer()
+	_, err := defs.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj any) { c.enqueue(obj) },
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the CRDs owned by a WidgetDefinition are informed.
+	owned := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dc, 0, metav1.NamespaceAll,
+		func(opts *metav1.ListOptions) {
+			opts.LabelSelector = LabelWidgetDefinition
+		}).ForResource(crdsGVR).Informer()
+	_, err = owned.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueOwner,
+		UpdateFunc: func(_, obj any) { c.enqueueOwner(obj) },
+		DeleteFunc: c.enqueueOwner,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.informers = []cache.SharedIndexInformer{defs, owned}
+
+	return c, nil
+}
+
+// Run starts the informers and the workers, and blocks until ctx is done.
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	defer c.queue.ShutDown()
+
+	synced := make([]cache.InformerSynced, 0, len(c.informers))
+	for _, el := range c.informers {
+		go el.RunWithContext(ctx)
+		synced = append(synced, el.HasSynced)
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("unable to sync %s informers", Resource)
+	}
+
+	c.log.Info("controller started", slog.Int("workers", workers))
+
+	for range workers {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for c.processNext(ctx) {
+			}
+		}, time.Second)
+	}
+
+	<-ctx.Done()
+	c.log.Info("controller stopped")
+
+	return nil
+}
+
+func (c *Controller) processNext(ctx context.Context) bool {
+	name, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(name)
+
+	start := time.Now()
+	requeue, err := c.reconciler.Reconcile(ctx, name)
+	if err != nil {
+		c.log.Error("unable to reconcile widget definition",
+			slog.String("name", name), slog.Any("err", err))
+		c.queue.AddRateLimited(name)
+		return true
+	}
+
+	c.queue.Forget(name)
+	if requeue > 0 {
+		c.queue.AddAfter(name, requeue)
+	}
+
+	c.log.Debug("widget definition reconciled",
+		slog.String("name", name), slog.Duration("duration", time.Since(start)))
+
+	return true
+}
+
+func (c *Controller) enqueue(obj any) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueOwner enqueues the WidgetDefinition owning a CRD.
+func (c *Controller) enqueueOwner(obj any) {
+	if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tomb.Obj
+	}
+
+	mo, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	if name := mo.GetLabels()[LabelWidgetDefinition]; len(name) > 0 {
+		c.queue.Add(name)
+	}
+}
@@ -0,0 +1,405 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/krateoplatformops/smithery/internal/audit"
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/forge"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	Group    = "smithery.krateo.io"
+	Version  = "v1alpha1"
+	Kind     = "WidgetDefinition"
+	Resource = "widgetdefinitions"
+
+	// Finalizer keeps a WidgetDefinition until its CRD has been deleted,
+	// which happens only when there are no more instances of the widget.
+	Finalizer = "smithery.krateo.io/crd-protection"
+
+	// LabelWidgetDefinition, set on the owned CRDs, is the name of their WidgetDefinition.
+	LabelWidgetDefinition = "smithery.krateo.io/widget-definition"
+)
+
+// WidgetDefinition status conditions.
+const (
+	ConditionGenerated       = "Generated"
+	ConditionEstablished     = "Established"
+	ConditionDeletionBlocked = "DeletionBlocked"
+)
+
+// Condition reasons.
+const (
+	ReasonInvalidSchema    = "InvalidSchema"
+	ReasonGenerateError    = "GenerateError"
+	ReasonDiscoveryError   = "DiscoveryError"
+	ReasonApplyError       = "ApplyError"
+	ReasonCRDConflict      = "CRDConflict"
+	ReasonApplied          = "Applied"
+	ReasonEstablished      = "Established"
+	ReasonPending          = "Pending"
+	ReasonNamesNotAccepted = "NamesNotAccepted"
+	ReasonInstancesExist   = "InstancesExist"
+)
+
+const (
+	establishPoll   = 5 * time.Second
+	deletionRecheck = 30 * time.Second
+)
+
+var (
+	GVR = schema.GroupVersionResource{Group: Group, Version: Version, Resource: Resource}
+
+	crdsGVR = schema.GroupVersionResource{
+		Group:    "apiextensions.k8s.io",
+		Version:  "v1",
+		Resource: "customresourcedefinitions",
+	}
+)
+
+// Status is the observed state of a WidgetDefinition.
+type Status struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	CRD                string             `json:"crd,omitempty"`
+	Kind               string             `json:"kind,omitempty"`
+	Version            string             `json:"version,omitempty"`
+	SchemaHash         string             `json:"schemaHash,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Reconciler forges the CRDs of the WidgetDefinitions.
+type Reconciler struct {
+	client dynamic.Interface
+	group  string
+	// discover, when set, expands the allowed resources selectors of the schemas.
+	discover forge.DiscoverFunc
+}
+
+func NewReconciler(client dynamic.Interface, group string) *Reconciler {
+	return &Reconciler{
+		client: client,
+		group:  group,
+	}
+}
+
+// Reconcile brings the CRD of the named WidgetDefinition in line with its schema.
+// A positive requeue asks to reconcile again after that delay.
+func (r *Reconciler) Reconcile(ctx context.Context, name string) (requeue time.Duration, err error) {
+	wd, err := r.client.Resource(GVR).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	status, err := getStatus(wd)
+	if err != nil {
+		return 0, err
+	}
+
+	if wd.GetDeletionTimestamp() != nil {
+		return r.finalize(ctx, wd, status)
+	}
+
+	if !slices.Contains(wd.GetFinalizers(), Finalizer) {
+		wd.SetFinalizers(append(wd.GetFinalizers(), Finalizer))
+		wd, err = r.client.Resource(GVR).Update(ctx, wd, metav1.UpdateOptions{})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	requeue = r.forge(ctx, wd, status)
+	status.ObservedGeneration = wd.GetGeneration()
+
+	return requeue, r.updateStatus(ctx, wd, status)
+}
+
+// forge generates and applies the CRD, recording the outcome in status.
+func (r *Reconciler) forge(ctx context.Context, wd *unstructured.Unstructured, status *Status) time.Duration {
+	gen := wd.GetGeneration()
+
+	notGenerated := func(reason string, err error) time.Duration {
+		setCondition(status, gen, ConditionGenerated, metav1.ConditionFalse, reason, err.Error())
+		return 0
+	}
+
+	src, ok, err := unstructured.NestedMap(wd.Object, "spec", "schema")
+	if err != nil {
+		return notGenerated(ReasonInvalidSchema, err)
+	}
+	if !ok {
+		return notGenerated(ReasonInvalidSchema, fmt.Errorf("spec.schema is required"))
+	}
+
+	w, err := forge.Parse(src)
+	if err != nil {
+		return notGenerated(ReasonInvalidSchema, err)
+	}
+
+	if w.Selector != nil && r.discover != nil {
+		if err := w.ExpandAllowedResources(ctx, r.discover); err != nil {
+			return notGenerated(ReasonDiscoveryError, err)
+		}
+	}
+
+	res, err := forge.Generate(r.group, w)
+	if err != nil {
+		return notGenerated(ReasonGenerateError, fmt.Errorf("unable to generate CRD: %w", err))
+	}
+
+	crd := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(res, &crd.Object); err != nil {
+		return notGenerated(ReasonGenerateError, fmt.Errorf("unable to decode generated CRD: %w", err))
+	}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+
+	labels := crd.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelWidgetDefinition] = wd.GetName()
+	crd.SetLabels(labels)
+	crd.SetOwnerReferences([]metav1.OwnerReference{ownerReference(wd)})
+
+	status.Kind, status.Version, status.CRD = w.Kind, w.Version, crd.GetName()
+	status.SchemaHash = schemaHash(src)
+
+	applied, err := r.applyCRD(ctx, wd, crd)
+	if err != nil {
+		reason := ReasonApplyError
+		var ce *conflictError
+		if errors.As(err, &ce) {
+			reason = ReasonCRDConflict
+		}
+		setCondition(status, gen, ConditionGenerated, metav1.ConditionFalse, reason, err.Error())
+		return 0
+	}
+
+	setCondition(status, gen, ConditionGenerated, metav1.ConditionTrue, ReasonApplied,
+		fmt.Sprintf("CRD %s applied", crd.GetName()))
+
+	for _, el := range crds.Conditions(applied.Object) {
+		switch {
+		case el.Type == crds.ConditionEstablished && el.Status == string(metav1.ConditionTrue):
+			setCondition(status, gen, ConditionEstablished, metav1.ConditionTrue, ReasonEstablished, el.Message)
+			return 0
+		case el.Type == crds.ConditionNamesAccepted && el.Status == string(metav1.ConditionFalse):
+			setCondition(status, gen, ConditionEstablished, metav1.ConditionFalse, ReasonNamesNotAccepted, el.Message)
+			return 0
+		}
+	}
+
+	setCondition(status, gen, ConditionEstablished, metav1.ConditionFalse, ReasonPending,
+		"waiting for the CRD to be established")
+	return establishPoll
+}
+
+// conflictError is returned when the CRD is controlled by someone else.
+type conflictError struct {
+	name  string
+	owner string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("CRD %q is controlled by %s", e.name, e.owner)
+}
+
+// applyCRD creates or updates the CRD. CRDs without a controller (i.e. forged
+// through the HTTP API) are adopted, the ones controlled by others are not touched.
+func (r *Reconciler) applyCRD(ctx context.Context, wd, crd *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	cli := r.client.Resource(crdsGVR)
+
+	existing, err := cli.Get(ctx, crd.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return cli.Create(ctx, crd, metav1.CreateOptions{})
+		}
+		return nil, err
+	}
+
+	if ref := metav1.GetControllerOf(existing); ref != nil && ref.UID != wd.GetUID() {
+		return nil, &conflictError{name: crd.GetName(), owner: fmt.Sprintf("%s %q", ref.Kind, ref.Name)}
+	}
+
+	crd.SetResourceVersion(existing.GetResourceVersion())
+	// The status is ignored on update, carry it over so the
+	// returned object reports the current conditions anyway.
+	if status, ok := existing.Object["status"]; ok {
+		crd.Object["status"] = status
+	}
+
+	// Keep the annotations set by others (i.e. the schema revision).
+	ann := existing.GetAnnotations()
+	if ann == nil {
+		ann = map[string]string{}
+	}
+	for k, v := range crd.GetAnnotations() {
+		ann[k] = v
+	}
+	crd.SetAnnotations(ann)
+
+	return cli.Update(ctx, crd, metav1.UpdateOptions{})
+}
+
+// finalize deletes the CRD owned by the WidgetDefinition, unless there are
+// instances of the widget, then releases the WidgetDefinition.
+func (r *Reconciler) finalize(ctx context.Context, wd *unstructured.Unstructured, status *Status) (time.Duration, error) {
+	if !slices.Contains(wd.GetFinalizers(), Finalizer) {
+		return 0, nil
+	}
+
+	if len(status.CRD) > 0 {
+		crd, err := r.client.Resource(crdsGVR).Get(ctx, status.CRD, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return 0, err
+		case isControlledBy(crd, wd):
+			count, err := r.countInstances(ctx, crd)
+			if err != nil {
+				return 0, err
+			}
+			if count > 0 {
+				setCondition(status, wd.GetGeneration(), ConditionDeletionBlocked, metav1.ConditionTrue, ReasonInstancesExist,
+					fmt.Sprintf("CRD %s still has instances, delete them first", status.CRD))
+				return deletionRecheck, r.updateStatus(ctx, wd, status)
+			}
+
+			err = r.client.Resource(crdsGVR).Delete(ctx, status.CRD, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return 0, err
+			}
+		}
+	}
+
+	wd.SetFinalizers(slices.DeleteFunc(wd.GetFinalizers(), func(s string) bool {
+		return s == Finalizer
+	}))
+	_, err := r.client.Resource(GVR).Update(ctx, wd, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	}
+	return 0, err
+}
+
+// countInstances returns how many instances of the CRD exist (at most one is listed).
+func (r *Reconciler) countInstances(ctx context.Context, crd *unstructured.Unstructured) (int, error) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+	for _, el := range versions {
+		ver, _ := el.(map[string]any)
+		if served, _ := ver["served"].(bool); !served {
+			continue
+		}
+		name, _ := ver["name"].(string)
+
+		all, err := r.client.Resource(schema.GroupVersionResource{
+			Group: group, Version: name, Resource: plural,
+		}).List(ctx, metav1.ListOptions{Limit: 1})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return 0, nil
+			}
+			return 0, err
+		}
+
+		// Any served version lists all the instances.
+		return len(all.Items), nil
+	}
+
+	return 0, nil
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, wd *unstructured.Unstructured, status *Status) error {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return err
+	}
+
+	wd = wd.DeepCopy()
+	wd.Object["status"] = obj
+
+	_, err = r.client.Resource(GVR).UpdateStatus(ctx, wd, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func getStatus(wd *unstructured.Unstructured) (*Status, error) {
+	status := &Status{}
+
+	obj, ok, err := unstructured.NestedMap(wd.Object, "status")
+	if err != nil || !ok {
+		return status, err
+	}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj, status)
+	return status, err
+}
+
+func setCondition(status *Status, generation int64, typ string, val metav1.ConditionStatus, reason, msg string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               typ,
+		Status:             val,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            msg,
+	})
+}
+
+// ownerReference is the controller reference of the CRD of wd. Unlike the one
+// of metav1.NewControllerRef it does not block the deletion of wd, which would
+// require the update of its finalizers besides the delete permission.
+func ownerReference(wd *unstructured.Unstructured) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion:         GVR.GroupVersion().String(),
+		Kind:               Kind,
+		Name:               wd.GetName(),
+		UID:                wd.GetUID(),
+		Controller:         ptr.To(true),
+		BlockOwnerDeletion: ptr.To(false),
+	}
+}
+
+// DefinitionOf returns the name of the WidgetDefinition controlling obj, if any.
+func DefinitionOf(obj metav1.Object) (string, bool) {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil || ref.Kind != Kind || ref.APIVersion != GVR.GroupVersion().String() {
+		return "", false
+	}
+	return ref.Name, true
+}
+
+func isControlledBy(obj, owner *unstructured.Unstructured) bool {
+	ref := metav1.GetControllerOf(obj)
+	return ref != nil && ref.UID == owner.GetUID()
+}
+
+func schemaHash(src map[string]any) string {
+	dat, err := json.Marshal(src)
+	if err != nil {
+		return ""
+	}
+	return audit.SchemaHash(dat)
+}
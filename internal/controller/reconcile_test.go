@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/smithery/internal/forge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+const crdName = "buttons.widgets.templates.krateo.io"
+
+var buttonsGVR = schema.GroupVersionResource{
+	Group: forge.DefaultGroup, Version: "v1beta1", Resource: "buttons",
+}
+
+func newWidgetDefinition(t *testing.T, schema map[string]any) *unstructured.Unstructured {
+	t.Helper()
+
+	wd := &unstructured.Unstructured{}
+	wd.SetAPIVersion(GVR.GroupVersion().String())
+	wd.SetKind(Kind)
+	wd.SetName("button")
+	wd.SetUID(types.UID("wd-uid"))
+	wd.SetGeneration(1)
+	if schema != nil {
+		require.NoError(t, unstructured.SetNestedMap(wd.Object, schema, "spec", "schema"))
+	}
+	return wd
+}
+
+func buttonSchema(t *testing.T) map[string]any {
+	t.Helper()
+
+	dat, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	res := map[string]any{}
+	require.NoError(t, json.Unmarshal(dat, &res))
+	return res
+}
+
+func newFakeClient(objs ...runtime.Object) *fake.FakeDynamicClient {
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			GVR:        "WidgetDefinitionList",
+			crdsGVR:    "CustomResourceDefinitionList",
+			buttonsGVR: "ButtonList",
+		}, objs...)
+}
+
+func getStatusOf(t *testing.T, cli *fake.FakeDynamicClient) *Status {
+	t.Helper()
+
+	wd, err := cli.Resource(GVR).Get(context.Background(), "button", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	status, err := getStatus(wd)
+	require.NoError(t, err)
+	return status
+}
+
+func TestReconcileInvalidSchema(t *testing.T) {
+	ctx := context.Background()
+	cli := newFakeClient(newWidgetDefinition(t, map[string]any{"type": "object"}))
+
+	requeue, err := NewReconciler(cli, forge.DefaultGroup).Reconcile(ctx, "button")
+	require.NoError(t, err)
+	assert.Zero(t, requeue)
+
+	status := getStatusOf(t, cli)
+	cond := meta.FindStatusCondition(status.Conditions, ConditionGenerated)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, ReasonInvalidSchema, cond.Reason)
+	assert.Contains(t, cond.Message, "unable to extract kind and version")
+
+	wd, err := cli.Resource(GVR).Get(ctx, "button", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, wd.GetFinalizers(), Finalizer)
+}
+
+func TestReconcileForgesAndOwnsCRD(t *testing.T) {
+	ctx := context.Background()
+	cli := newFakeClient(newWidgetDefinition(t, buttonSchema(t)))
+	rec := NewReconciler(cli, forge.DefaultGroup)
+
+	requeue, err := rec.Reconcile(ctx, "button")
+	require.NoError(t, err)
+	assert.Equal(t, establishPoll, requeue)
+
+	crd, err := cli.Resource(crdsGVR).Get(ctx, crdName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "button", crd.GetLabels()[LabelWidgetDefinition])
+	ref := metav1.GetControllerOf(crd)
+	require.NotNil(t, ref)
+	assert.Equal(t, types.UID("wd-uid"), ref.UID)
+	require.NotNil(t, ref.BlockOwnerDeletion)
+	assert.False(t, *ref.BlockOwnerDeletion)
+
+	name, ok := DefinitionOf(crd)
+	assert.True(t, ok)
+	assert.Equal(t, "button", name)
+
+	status := getStatusOf(t, cli)
+	assert.Equal(t, crdName, status.CRD)
+	assert.Equal(t, "Button", status.Kind)
+	assert.Equal(t, "v1beta1", status.Version)
+	assert.Equal(t, int64(1), status.ObservedGeneration)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, ConditionGenerated))
+	cond := meta.FindStatusCondition(status.Conditions, ConditionEstablished)
+	require.NotNil(t, cond)
+	assert.Equal(t, ReasonPending, cond.Reason)
+
+	// The API server establishes the CRD.
+	require.NoError(t, unstructured.SetNestedSlice(crd.Object, []any{
+		map[string]any{"type": "Established", "status": "True", "message": "the initial names have been accepted"},
+	}, "status", "conditions"))
+	_, err = cli.Resource(crdsGVR).Update(ctx, crd, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	requeue, err = rec.Reconcile(ctx, "button")
+	require.NoError(t, err)
+	assert.Zero(t, requeue)
+	assert.True(t, meta.IsStatusConditionTrue(getStatusOf(t, cli).Conditions, ConditionEstablished))
+}
+
+func TestReconcileCRDConflict(t *testing.T) {
+	ctx := context.Background()
+
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName(crdName)
+	crd.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: GVR.GroupVersion().String(), Kind: Kind, Name: "other", UID: "other-uid",
+		Controller: func(b bool) *bool { return &b }(true),
+	}})
+
+	cli := newFakeClient(newWidgetDefinition(t, buttonSchema(t)), crd)
+
+	_, err := NewReconciler(cli, forge.DefaultGroup).Reconcile(ctx, "button")
+	require.NoError(t, err)
+
+	cond := meta.FindStatusCondition(getStatusOf(t, cli).Conditions, ConditionGenerated)
+	require.NotNil(t, cond)
+	assert.Equal(t, ReasonCRDConflict, cond.Reason)
+	assert.Contains(t, cond.Message, `WidgetDefinition "other"`)
+}
+
+func TestReconcileDeletion(t *testing.T) {
+	ctx := context.Background()
+	cli := newFakeClient(newWidgetDefinition(t, buttonSchema(t)))
+	rec := NewReconciler(cli, forge.DefaultGroup)
+
+	_, err := rec.Reconcile(ctx, "button")
+	require.NoError(t, err)
+
+	// The API server marks the WidgetDefinition as deleted, keeping it for the finalizer.
+	wd, err := cli.Resource(GVR).Get(ctx, "button", metav1.GetOptions{})
+	require.NoError(t, err)
+	now := metav1.NewTime(time.Now())
+	wd.SetDeletionTimestamp(&now)
+	_, err = cli.Resource(GVR).Update(ctx, wd, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	instance := &unstructured.Unstructured{}
+	instance.SetAPIVersion(buttonsGVR.GroupVersion().String())
+	instance.SetKind("Button")
+	instance.SetNamespace("demo-system")
+	instance.SetName("ok")
+	_, err = cli.Resource(buttonsGVR).Namespace("demo-system").Create(ctx, instance, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	requeue, err := rec.Reconcile(ctx, "button")
+	require.NoError(t, err)
+	assert.Equal(t, deletionRecheck, requeue)
+	assert.True(t, meta.IsStatusConditionTrue(getStatusOf(t, cli).Conditions, ConditionDeletionBlocked))
+
+	_, err = cli.Resource(crdsGVR).Get(ctx, crdName, metav1.GetOptions{})
+	require.NoError(t, err, "the CRD must be kept while instances exist")
+
+	require.NoError(t, cli.Resource(buttonsGVR).Namespace("demo-system").Delete(ctx, "ok", metav1.DeleteOptions{}))
+
+	requeue, err = rec.Reconcile(ctx, "button")
+	require.NoError(t, err)
+	assert.Zero(t, requeue)
+
+	_, err = cli.Resource(crdsGVR).Get(ctx, crdName, metav1.GetOptions{})
+	assert.Error(t, err, "the CRD must be deleted")
+
+	wd, err = cli.Resource(GVR).Get(ctx, "button", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, wd.GetFinalizers(), Finalizer)
+}
+
+func TestReconcileDiscoveryError(t *testing.T) {
+	ctx := context.Background()
+
+	src := buttonSchema(t)
+	require.NoError(t, unstructured.SetNestedField(src, map[string]any{"category": "widgets"},
+		"properties", "spec", "properties", "widgetData", "properties", "allowedResources", forge.SelectorKeyword))
+	unstructured.RemoveNestedField(src,
+		"properties", "spec", "properties", "widgetData", "properties", "allowedResources", "enum")
+
+	cli := newFakeClient(newWidgetDefinition(t, src))
+	rec := NewReconciler(cli, forge.DefaultGroup)
+	rec.discover = func(context.Context, string, string) ([]schema.GroupVersionResource, error) {
+		return nil, errors.New("discovery unavailable")
+	}
+
+	_, err := rec.Reconcile(ctx, "button")
+	require.NoError(t, err)
+
+	cond := meta.FindStatusCondition(getStatusOf(t, cli).Conditions, ConditionGenerated)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, ReasonDiscoveryError, cond.Reason)
+	assert.Contains(t, cond.Message, "discovery unavailable")
+}
@@ -0,0 +1,149 @@
+package crds
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/krateoplatformops/plumbing/env"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	runtimeschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+var crdsGVR = runtimeschema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// Cache keeps an in-memory copy of the CRDs belonging to a single API group.
+// It is fed by a shared informer that runs with its own credentials (usually
+// the service account ones), so callers must check the user permissions on
+// their own before serving its content.
+type Cache struct {
+	group    string
+	informer cache.SharedIndexInformer
+}
+
+func NewCache(rc *rest.Config, group string) (*Cache, error) {
+	if rc == nil {
+		if env.TestMode() {
+			return nil, fmt.Errorf("with 'test mode' enabled rest.Config cannot be nil")
+		}
+
+		var err error
+		rc, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dc, err := dynamic.NewForConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCache(dc, group)
+}
+
+func newCache(dc dynamic.Interface, group string) (*Cache, error) {
+	inf := dynamicinformer.NewDynamicSharedInformerFactory(dc, 0).
+		ForResource(crdsGVR).Informer()
+
+	// CRDs of other groups are informed too (there is no server side
+	// filter on spec.group), shrink them so they do not waste memory.
+	err := inf.SetTransform(func(obj any) (any, error) {
+		uns, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return obj, nil
+		}
+
+		uns.SetManagedFields(nil)
+		if crdGroup(uns.Object) == group {
+			return uns, nil
+		}
+
+		min := &unstructured.Unstructured{}
+		min.SetAPIVersion(uns.GetAPIVersion())
+		min.SetKind(uns.GetKind())
+		min.SetName(uns.GetName())
+		min.SetResourceVersion(uns.GetResourceVersion())
+		unstructured.SetNestedField(min.Object, crdGroup(uns.Object), "spec", "group")
+		return min, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		group:    group,
+		informer: inf,
+	}, nil
+}
+
+// Start runs the informer until ctx is done and blocks until
+// the first full list has been stored.
+func (c *Cache) Start(ctx context.Context) error {
+	go c.informer.RunWithContext(ctx)
+
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return fmt.Errorf("unable to sync CRDs cache for group %q", c.group)
+	}
+
+	return nil
+}
+
+// Ready reports whether the cache can serve requests.
+// It is safe to call on a nil *Cache.
+func (c *Cache) Ready() bool {
+	return c != nil && c.informer.HasSynced()
+}
+
+// Get returns the CRD with the specified name, if it belongs to the cached group.
+func (c *Cache) Get(name string) (map[string]any, bool) {
+	obj, ok, err := c.informer.GetStore().GetByKey(name)
+	if err != nil || !ok {
+		return nil, false
+	}
+
+	uns, ok := obj.(*unstructured.Unstructured)
+	if !ok || crdGroup(uns.Object) != c.group {
+		return nil, false
+	}
+
+	return uns.DeepCopy().UnstructuredContent(), true
+}
+
+// List returns all the CRDs of the cached group sorted by name.
+func (c *Cache) List() []map[string]any {
+	all := c.informer.GetStore().List()
+
+	res := make([]map[string]any, 0, len(all))
+	for _, obj := range all {
+		uns, ok := obj.(*unstructured.Unstructured)
+		if !ok || crdGroup(uns.Object) != c.group {
+			continue
+		}
+		res = append(res, uns.DeepCopy().UnstructuredContent())
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return getName(res[i]) < getName(res[j])
+	})
+
+	return res
+}
+
+func crdGroup(crd map[string]any) string {
+	group, _, _ := unstructured.NestedString(crd, "spec", "group")
+	return group
+}
+
+func getName(obj map[string]any) string {
+	name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+	return name
+}
@@ -0,0 +1,81 @@
+package crds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestCache(t *testing.T) {
+	newCRD := func(name, group string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]any{
+				"name": name,
+			},
+			"spec": map[string]any{
+				"group": group,
+				"versions": []any{
+					map[string]any{
+						"name": "v1",
+						"schema": map[string]any{
+							"openAPIV3Schema": map[string]any{"type": "object"},
+						},
+					},
+				},
+			},
+		}}
+	}
+
+	dc := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[runtimeschema.GroupVersionResource]string{crdsGVR: "CustomResourceDefinitionList"},
+		newCRD("tables.widgets.example.io", "widgets.example.io"),
+		newCRD("buttons.widgets.example.io", "widgets.example.io"),
+		newCRD("pods.other.example.io", "other.example.io"),
+	)
+
+	var nilCache *Cache
+	assert.False(t, nilCache.Ready())
+
+	store, err := newCache(dc, "widgets.example.io")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, store.Start(ctx))
+	assert.True(t, store.Ready())
+
+	t.Run("list only the cached group", func(t *testing.T) {
+		all := store.List()
+		require.Len(t, all, 2)
+		assert.Equal(t, "buttons.widgets.example.io", getName(all[0]))
+		assert.Equal(t, "tables.widgets.example.io", getName(all[1]))
+	})
+
+	t.Run("get a cached CRD", func(t *testing.T) {
+		got, ok := store.Get("buttons.widgets.example.io")
+		require.True(t, ok)
+
+		sch, err := OpenAPISchema(got, "v1")
+		assert.NoError(t, err)
+		assert.Equal(t, "object", sch["type"])
+	})
+
+	t.Run("CRD of another group", func(t *testing.T) {
+		_, ok := store.Get("pods.other.example.io")
+		assert.False(t, ok)
+	})
+
+	t.Run("unknown CRD", func(t *testing.T) {
+		_, ok := store.Get("unknown.widgets.example.io")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,130 @@
+package crds
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+	OpenAPI3Version   = "3.0.3"
+)
+
+// ToJSONSchema converts a CRD OpenAPI v3 schema to a JSON Schema draft 2020-12
+// document: 'nullable' and 'x-kubernetes-int-or-string' are mapped to the
+// equivalent type lists and the other 'x-kubernetes-*' extensions are dropped.
+func ToJSONSchema(schema map[string]any) map[string]any {
+	res := toJSONSchema(runtime.DeepCopyJSON(schema))
+	res["$schema"] = JSONSchemaDialect
+	return res
+}
+
+// ToOpenAPI3 wraps a CRD OpenAPI v3 schema in an OpenAPI 3 document,
+// with the schema published under 'components.schemas' with a name
+// like 'io.krateo.templates.widgets.v1beta1.Button'.
+func ToOpenAPI3(schema map[string]any, group, version, kind string) map[string]any {
+	name := strings.Join([]string{reverseDomain(group), version, kind}, ".")
+
+	return map[string]any{
+		"openapi": OpenAPI3Version,
+		"info": map[string]any{
+			"title":   kind,
+			"version": version,
+		},
+		"paths": map[string]any{},
+		"components": map[string]any{
+			"schemas": map[string]any{
+				name: toOpenAPI3(runtime.DeepCopyJSON(schema)),
+			},
+		},
+	}
+}
+
+func toJSONSchema(node map[string]any) map[string]any {
+	if ok, _ := node["x-kubernetes-int-or-string"].(bool); ok {
+		delete(node, "anyOf")
+		node["type"] = []any{"integer", "string"}
+	}
+
+	if ok, _ := node["nullable"].(bool); ok {
+		switch typ := node["type"].(type) {
+		case string:
+			node["type"] = []any{typ, "null"}
+		case []any:
+			node["type"] = append(typ, "null")
+		}
+		if enum, ok := node["enum"].([]any); ok {
+			node["enum"] = append(enum, nil)
+		}
+	}
+	delete(node, "nullable")
+
+	if val, ok := node["example"]; ok {
+		node["examples"] = []any{val}
+		delete(node, "example")
+	}
+
+	for key := range node {
+		if strings.HasPrefix(key, "x-kubernetes-") {
+			delete(node, key)
+		}
+	}
+
+	walkSubSchemas(node, toJSONSchema)
+
+	return node
+}
+
+func toOpenAPI3(node map[string]any) map[string]any {
+	// OpenAPI 3.0 has no type lists: express int-or-string with 'anyOf'.
+	if ok, _ := node["x-kubernetes-int-or-string"].(bool); ok {
+		if _, found := node["anyOf"]; !found {
+			node["anyOf"] = []any{
+				map[string]any{"type": "integer"},
+				map[string]any{"type": "string"},
+			}
+		}
+	}
+
+	walkSubSchemas(node, toOpenAPI3)
+
+	return node
+}
+
+// walkSubSchemas applies fn to all the schemas nested in node.
+func walkSubSchemas(node map[string]any, fn func(map[string]any) map[string]any) {
+	for _, key := range []string{"properties", "patternProperties"} {
+		if props, ok := node[key].(map[string]any); ok {
+			for name, el := range props {
+				if sub, ok := el.(map[string]any); ok {
+					props[name] = fn(sub)
+				}
+			}
+		}
+	}
+
+	for _, key := range []string{"items", "additionalProperties", "not"} {
+		if sub, ok := node[key].(map[string]any); ok {
+			node[key] = fn(sub)
+		}
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		if all, ok := node[key].([]any); ok {
+			for i, el := range all {
+				if sub, ok := el.(map[string]any); ok {
+					all[i] = fn(sub)
+				}
+			}
+		}
+	}
+}
+
+func reverseDomain(name string) string {
+	parts := strings.Split(name, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,92 @@
+package crds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newConvertSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"spec": map[string]any{
+				"type":                                 "object",
+				"x-kubernetes-preserve-unknown-fields": true,
+				"properties": map[string]any{
+					"port": map[string]any{
+						"x-kubernetes-int-or-string": true,
+						"anyOf": []any{
+							map[string]any{"type": "integer"},
+							map[string]any{"type": "string"},
+						},
+					},
+					"color": map[string]any{
+						"type":     "string",
+						"nullable": true,
+						"enum":     []any{"red", "green"},
+						"example":  "red",
+					},
+					"items": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type":     "object",
+							"nullable": true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestToJSONSchema(t *testing.T) {
+	src := newConvertSchema()
+	got := ToJSONSchema(src)
+
+	want := map[string]any{
+		"$schema": JSONSchemaDialect,
+		"type":    "object",
+		"properties": map[string]any{
+			"spec": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"port": map[string]any{
+						"type": []any{"integer", "string"},
+					},
+					"color": map[string]any{
+						"type":     []any{"string", "null"},
+						"enum":     []any{"red", "green", nil},
+						"examples": []any{"red"},
+					},
+					"items": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": []any{"object", "null"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, want, got)
+	assert.Equal(t, newConvertSchema(), src, "source schema must be left untouched")
+}
+
+func TestToOpenAPI3(t *testing.T) {
+	got := ToOpenAPI3(newConvertSchema(), "widgets.templates.krateo.io", "v1beta1", "Button")
+
+	assert.Equal(t, OpenAPI3Version, got["openapi"])
+
+	schemas := got["components"].(map[string]any)["schemas"].(map[string]any)
+	button, ok := schemas["io.krateo.templates.widgets.v1beta1.Button"].(map[string]any)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	spec := button["properties"].(map[string]any)["spec"].(map[string]any)
+	color := spec["properties"].(map[string]any)["color"].(map[string]any)
+	assert.Equal(t, true, color["nullable"])
+	assert.Equal(t, true, spec["x-kubernetes-preserve-unknown-fields"])
+}
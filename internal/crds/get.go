@@ -11,12 +11,18 @@ import (
 )
 
 type GetOptions struct {
-	RC      *rest.Config
+	RC *rest.Config
+	// Client, when set, is used instead of creating a new one from RC.
+	Client  *dynamic.UnstructuredClient
 	Name    string
 	Version string
 }
 
 func Get(ctx context.Context, opts GetOptions) (map[string]any, error) {
+	if opts.Client != nil {
+		return get(ctx, opts.Client, opts.Name)
+	}
+
 	if opts.RC == nil {
 		if env.TestMode() {
 			return map[string]any{}, fmt.Errorf("with 'test mode' enabled rest.Config cannot be nil")
@@ -34,7 +40,11 @@ func Get(ctx context.Context, opts GetOptions) (map[string]any, error) {
 		return map[string]any{}, err
 	}
 
-	got, err := cli.Get(ctx, opts.Name, dynamic.Options{
+	return get(ctx, cli, opts.Name)
+}
+
+func get(ctx context.Context, cli *dynamic.UnstructuredClient, name string) (map[string]any, error) {
+	got, err := cli.Get(ctx, name, dynamic.Options{
 		GVR: runtimeschema.GroupVersionResource{
 			Group:    "apiextensions.k8s.io",
 			Version:  "v1",
@@ -39,6 +39,46 @@ func OpenAPISchema(crd map[string]any, version string) (map[string]any, error) {
 	return nil, fmt.Errorf("version [%s] not found in CRD schema", version)
 }
 
+// OpenAPISchemas returns the OpenAPI v3 schemas of all the served versions of a CRD, keyed by version name.
+func OpenAPISchemas(crd map[string]any) (map[string]map[string]any, error) {
+	versions, found, err := unstructured.NestedSlice(crd, "spec", "versions")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no versions found in CRD")
+	}
+
+	res := make(map[string]map[string]any, len(versions))
+	for _, v := range versions {
+		versionMap, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if served, ok := versionMap["served"].(bool); ok && !served {
+			continue
+		}
+
+		name, ok := versionMap["name"].(string)
+		if !ok {
+			continue
+		}
+
+		schemaData, exists, err := unstructured.NestedMap(versionMap, "schema", "openAPIV3Schema")
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("schema OpenAPI v3 not found for version: %s", name)
+		}
+
+		res[name] = schemaData
+	}
+
+	return res, nil
+}
+
 func OpenAPISchemaToCustomResourceValidation(schemaData map[string]any) (*apiextensions.CustomResourceValidation, error) {
 	schemaProps := &apiextensions.JSONSchemaProps{}
 	err := runtime.DefaultUnstructuredConverter.FromUnstructured(schemaData, schemaProps)
@@ -61,3 +61,43 @@ func TestExtractOpenAPISchemaFromCRD(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestOpenAPISchemas(t *testing.T) {
+	crd := map[string]any{
+		"spec": map[string]any{
+			"versions": []any{
+				map[string]any{
+					"name":   "v1alpha1",
+					"served": false,
+					"schema": map[string]any{
+						"openAPIV3Schema": map[string]any{"type": "object"},
+					},
+				},
+				map[string]any{
+					"name":   "v1beta1",
+					"served": true,
+					"schema": map[string]any{
+						"openAPIV3Schema": map[string]any{"type": "object"},
+					},
+				},
+				map[string]any{
+					"name":   "v1",
+					"served": true,
+					"schema": map[string]any{
+						"openAPIV3Schema": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+
+	got, err := OpenAPISchemas(crd)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]any{
+		"v1beta1": {"type": "object"},
+		"v1":      {"type": "string"},
+	}, got)
+
+	_, err = OpenAPISchemas(map[string]any{"spec": map[string]any{}})
+	assert.EqualError(t, err, "no versions found in CRD")
+}
@@ -0,0 +1,81 @@
+package crds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathNotFoundError is returned when a segment of a sub-schema path
+// does not exist in the OpenAPI schema.
+type PathNotFoundError struct {
+	Path    string
+	Segment string
+}
+
+func (e *PathNotFoundError) Error() string {
+	return fmt.Sprintf("segment %q of path %q not found in schema", e.Segment, e.Path)
+}
+
+// SubSchema returns the subtree of an OpenAPI schema identified by path.
+//
+// The path can be either a JSON Pointer (RFC 6901), such as
+// '/properties/spec/properties/widgetData', or a dotted field path like
+// the one accepted by 'kubectl explain', such as 'spec.widgetData'.
+// Dotted paths walk through array items transparently.
+func SubSchema(schema map[string]any, path string) (any, error) {
+	switch {
+	case len(path) == 0 || path == "/":
+		return schema, nil
+	case strings.HasPrefix(path, "/"):
+		return pointerLookup(schema, path)
+	default:
+		return fieldLookup(schema, path)
+	}
+}
+
+func pointerLookup(schema map[string]any, path string) (any, error) {
+	var cur any = schema
+	for _, tok := range strings.Split(path[1:], "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+
+		var ok bool
+		switch node := cur.(type) {
+		case map[string]any:
+			cur, ok = node[tok]
+		case []any:
+			idx, err := strconv.Atoi(tok)
+			if ok = err == nil && idx >= 0 && idx < len(node); ok {
+				cur = node[idx]
+			}
+		}
+		if !ok {
+			return nil, &PathNotFoundError{Path: path, Segment: tok}
+		}
+	}
+
+	return cur, nil
+}
+
+func fieldLookup(schema map[string]any, path string) (any, error) {
+	cur := schema
+	for _, field := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		// Walk through arrays like 'kubectl explain' does.
+		for cur["type"] == "array" {
+			items, ok := cur["items"].(map[string]any)
+			if !ok {
+				break
+			}
+			cur = items
+		}
+
+		props, _ := cur["properties"].(map[string]any)
+		next, ok := props[field].(map[string]any)
+		if !ok {
+			return nil, &PathNotFoundError{Path: path, Segment: field}
+		}
+		cur = next
+	}
+
+	return cur, nil
+}
@@ -0,0 +1,95 @@
+package crds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubSchema(t *testing.T) {
+	widgetData := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"label": map[string]any{"type": "string"},
+		},
+	}
+
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"spec": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"widgetData": widgetData,
+					"resourcesRefs": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"id": map[string]any{"type": "string"},
+							},
+						},
+					},
+					"a/b": map[string]any{"type": "string"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    any
+		segment string
+	}{
+		{name: "empty path", path: "", want: schema},
+		{name: "root pointer", path: "/", want: schema},
+		{
+			name: "json pointer",
+			path: "/properties/spec/properties/widgetData",
+			want: widgetData,
+		},
+		{
+			name: "json pointer to a scalar",
+			path: "/properties/spec/properties/widgetData/type",
+			want: "object",
+		},
+		{
+			name: "json pointer escaping",
+			path: "/properties/spec/properties/a~1b",
+			want: map[string]any{"type": "string"},
+		},
+		{name: "dotted path", path: "spec.widgetData", want: widgetData},
+		{
+			name: "dotted path through array items",
+			path: "spec.resourcesRefs.id",
+			want: map[string]any{"type": "string"},
+		},
+		{
+			name:    "json pointer missing segment",
+			path:    "/properties/spec/properties/widgetDatas/type",
+			segment: "widgetDatas",
+		},
+		{
+			name:    "dotted path missing segment",
+			path:    "spec.widgetData.color",
+			segment: "color",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SubSchema(schema, tc.path)
+			if len(tc.segment) > 0 {
+				var pnf *PathNotFoundError
+				if assert.ErrorAs(t, err, &pnf) {
+					assert.Equal(t, tc.segment, pnf.Segment)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
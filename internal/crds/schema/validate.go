@@ -4,25 +4,51 @@ import (
 	"encoding/json"
 	"errors"
 
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
+// ValidateCustomResource validates a custom resource against the schema of its
+// version in the CRD, returning one error for each invalid field.
+func ValidateCustomResource(crd, obj map[string]any) (field.ErrorList, error) {
+	schemaData, err := crds.OpenAPISchema(crd, dynamic.GroupVersion(obj).Version)
+	if err != nil {
+		return nil, err
+	}
+
+	crv, err := crds.OpenAPISchemaToCustomResourceValidation(schemaData)
+	if err != nil {
+		return nil, err
+	}
+
+	return customResourceErrors(crv, obj)
+}
+
 func validateCustomResource(crv *apiextensions.CustomResourceValidation, document []byte) error {
 	var jsonObj map[string]any
 	if err := json.Unmarshal(document, &jsonObj); err != nil {
 		return err
 	}
 
-	validator, _, err := validation.NewSchemaValidator(crv.OpenAPIV3Schema)
+	errs, err := customResourceErrors(crv, jsonObj)
 	if err != nil {
 		return err
 	}
-
-	errs := validation.ValidateCustomResource(nil, jsonObj, validator)
 	if len(errs) == 0 {
 		return nil
 	}
 
 	return errors.New(errs.ToAggregate().Error())
 }
+
+func customResourceErrors(crv *apiextensions.CustomResourceValidation, obj map[string]any) (field.ErrorList, error) {
+	validator, _, err := validation.NewSchemaValidator(crv.OpenAPIV3Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return validation.ValidateCustomResource(nil, obj, validator), nil
+}
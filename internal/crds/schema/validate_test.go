@@ -38,3 +38,56 @@ func TestValidate(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestValidateCustomResource(t *testing.T) {
+	crd := map[string]any{
+		"spec": map[string]any{
+			"versions": []any{
+				map[string]any{
+					"name": "v1beta1",
+					"schema": map[string]any{
+						"openAPIV3Schema": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"spec": map[string]any{
+									"type":     "object",
+									"required": []any{"label"},
+									"properties": map[string]any{
+										"label": map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	obj := func(version string, spec map[string]any) map[string]any {
+		return map[string]any{
+			"apiVersion": "widgets.templates.krateo.io/" + version,
+			"kind":       "Button",
+			"spec":       spec,
+		}
+	}
+
+	errs, err := ValidateCustomResource(crd, obj("v1beta1", map[string]any{"label": "ok"}))
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+
+	errs, err = ValidateCustomResource(crd, obj("v1beta1", map[string]any{"label": 1}))
+	assert.NoError(t, err)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "spec.label", errs[0].Field)
+	}
+
+	errs, err = ValidateCustomResource(crd, obj("v1beta1", map[string]any{}))
+	assert.NoError(t, err)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "spec.label", errs[0].Field)
+	}
+
+	_, err = ValidateCustomResource(crd, obj("v2", nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package crds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	ConditionEstablished   = "Established"
+	ConditionNamesAccepted = "NamesAccepted"
+)
+
+type Condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// NamesNotAcceptedError is returned when the API server
+// rejects the names of a CRD (i.e. they conflict with another CRD).
+type NamesNotAcceptedError struct {
+	Name    string
+	Reason  string
+	Message string
+}
+
+func (e *NamesNotAcceptedError) Error() string {
+	return fmt.Sprintf("names of CRD %q not accepted (%s): %s", e.Name, e.Reason, e.Message)
+}
+
+// Conditions returns the status conditions of a CRD.
+func Conditions(crd map[string]any) []Condition {
+	all, _, _ := unstructured.NestedSlice(crd, "status", "conditions")
+
+	res := make([]Condition, 0, len(all))
+	for _, el := range all {
+		cond, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		str := func(key string) string {
+			val, _ := cond[key].(string)
+			return val
+		}
+
+		res = append(res, Condition{
+			Type:               str("type"),
+			Status:             str("status"),
+			Reason:             str("reason"),
+			Message:            str("message"),
+			LastTransitionTime: str("lastTransitionTime"),
+		})
+	}
+
+	return res
+}
+
+// WaitForEstablished watches the CRD until it reports the Established condition
+// and returns the last seen conditions. It fails early with a *NamesNotAcceptedError
+// when the CRD names are rejected.
+func WaitForEstablished(ctx context.Context, cli *dynamic.UnstructuredClient, name string, timeout time.Duration) ([]Condition, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	notEstablished := func(err error) error {
+		if wait.Interrupted(err) {
+			return fmt.Errorf("CRD %q not established after %s: %w", name, timeout, err)
+		}
+		return err
+	}
+
+	var conds []Condition
+	for {
+		crd, err := get(ctx, cli, name)
+		if err != nil {
+			return conds, notEstablished(err)
+		}
+
+		conds = Conditions(crd)
+		if ok, err := established(name, conds); ok || err != nil {
+			return conds, err
+		}
+
+		rv, _, _ := unstructured.NestedString(crd, "metadata", "resourceVersion")
+		w, err := cli.Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+			ResourceVersion: rv,
+		}, dynamic.Options{GVR: crdsGVR})
+		if err != nil {
+			return conds, notEstablished(err)
+		}
+
+		done, err := watchConditions(w, name, &conds)
+		if done {
+			return conds, err
+		}
+
+		// The watch has been closed: give up on timeout, otherwise start over.
+		if err := ctx.Err(); err != nil {
+			return conds, notEstablished(err)
+		}
+	}
+}
+
+// watchConditions consumes the watch events updating conds, until the CRD is
+// established or rejected (done is true) or the watch is closed.
+func watchConditions(w watch.Interface, name string, conds *[]Condition) (done bool, err error) {
+	defer w.Stop()
+
+	for ev := range w.ResultChan() {
+		switch ev.Type {
+		case watch.Added, watch.Modified:
+			uns, ok := ev.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			*conds = Conditions(uns.Object)
+			if ok, err := established(name, *conds); ok || err != nil {
+				return true, err
+			}
+		case watch.Deleted:
+			return true, apierrors.NewNotFound(crdsGVR.GroupResource(), name)
+		case watch.Error:
+			return false, nil
+		}
+	}
+
+	return false, nil
+}
+
+func established(name string, conds []Condition) (bool, error) {
+	ok := false
+	for _, el := range conds {
+		switch el.Type {
+		case ConditionNamesAccepted:
+			if el.Status == "False" {
+				return false, &NamesNotAcceptedError{
+					Name:    name,
+					Reason:  el.Reason,
+					Message: el.Message,
+				}
+			}
+		case ConditionEstablished:
+			ok = el.Status == "True"
+		}
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,122 @@
+package crds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestEstablished(t *testing.T) {
+	newCRD := func(conds ...map[string]any) map[string]any {
+		all := make([]any, 0, len(conds))
+		for _, el := range conds {
+			all = append(all, el)
+		}
+		return map[string]any{
+			"status": map[string]any{
+				"conditions": all,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		crd     map[string]any
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "no conditions yet",
+			crd:  map[string]any{},
+		},
+		{
+			name: "names accepted, not yet established",
+			crd: newCRD(
+				map[string]any{"type": "NamesAccepted", "status": "True"},
+				map[string]any{"type": "Established", "status": "False"},
+			),
+		},
+		{
+			name: "established",
+			crd: newCRD(
+				map[string]any{"type": "NamesAccepted", "status": "True"},
+				map[string]any{"type": "Established", "status": "True"},
+			),
+			want: true,
+		},
+		{
+			name: "names not accepted",
+			crd: newCRD(
+				map[string]any{"type": "NamesAccepted", "status": "False",
+					"reason": "MultipleNamesConflict", "message": "\"buttons\" is already in use"},
+				map[string]any{"type": "Established", "status": "False"},
+			),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := established("buttons.widgets.templates.krateo.io", Conditions(tc.crd))
+			if tc.wantErr {
+				var nna *NamesNotAcceptedError
+				assert.ErrorAs(t, err, &nna)
+				assert.Equal(t, "MultipleNamesConflict", nna.Reason)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestWatchConditions(t *testing.T) {
+	newCRD := func(status string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"metadata": map[string]any{"name": "buttons.widgets.templates.krateo.io"},
+			"status": map[string]any{
+				"conditions": []any{
+					map[string]any{"type": "NamesAccepted", "status": "True"},
+					map[string]any{"type": "Established", "status": status},
+				},
+			},
+		}}
+	}
+
+	t.Run("established", func(t *testing.T) {
+		w := watch.NewFakeWithChanSize(2, false)
+		w.Modify(newCRD("False"))
+		w.Modify(newCRD("True"))
+
+		var conds []Condition
+		done, err := watchConditions(w, "buttons.widgets.templates.krateo.io", &conds)
+		assert.True(t, done)
+		assert.NoError(t, err)
+		assert.Len(t, conds, 2)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		w := watch.NewFakeWithChanSize(1, false)
+		w.Delete(newCRD("False"))
+
+		var conds []Condition
+		done, err := watchConditions(w, "buttons.widgets.templates.krateo.io", &conds)
+		assert.True(t, done)
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		w := watch.NewFakeWithChanSize(1, false)
+		w.Modify(newCRD("False"))
+		w.Stop()
+
+		var conds []Condition
+		done, err := watchConditions(w, "buttons.widgets.templates.krateo.io", &conds)
+		assert.False(t, done)
+		assert.NoError(t, err)
+	})
+}
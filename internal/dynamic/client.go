@@ -7,14 +7,17 @@ import (
 	"strings"
 
 	"github.com/krateoplatformops/plumbing/env"
+	"github.com/krateoplatformops/smithery/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
-	cacheddiscovery "k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
@@ -33,24 +36,31 @@ func NewClient(rc *rest.Config) (*UnstructuredClient, error) {
 		}
 	}
 
-	dynamicClient, err := dynamic.NewForConfig(rc)
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(rc)
 	if err != nil {
 		return nil, err
 	}
 
-	discoveryClient, err := discovery.NewDiscoveryClientForConfig(rc)
+	return newClient(rc, newCachedDiscovery(discoveryClient, DefaultResetInterval))
+}
+
+// newClient creates a client that resolves kinds and resources
+// using the specified (possibly shared) cached discovery.
+func newClient(rc *rest.Config, dc *cachedDiscovery) (*UnstructuredClient, error) {
+	rc = rest.CopyConfig(rc)
+	tracing.WrapConfig(rc)
+
+	dynamicClient, err := dynamic.NewForConfig(rc)
 	if err != nil {
 		return nil, err
 	}
 
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(
-		cacheddiscovery.NewMemCacheClient(discoveryClient),
-	)
-
 	return &UnstructuredClient{
+		rc:              rc,
 		dynamicClient:   dynamicClient,
-		discoveryClient: discoveryClient,
-		mapper:          mapper,
+		discoveryClient: dc.client,
+		discovery:       dc,
+		mapper:          dc.mapper,
 		converter:       runtime.DefaultUnstructuredConverter,
 	}, nil
 }
@@ -62,14 +72,24 @@ type Options struct {
 }
 
 type UnstructuredClient struct {
+	rc              *rest.Config
 	dynamicClient   *dynamic.DynamicClient
 	discoveryClient discovery.DiscoveryInterface
+	discovery       *cachedDiscovery
 	mapper          *restmapper.DeferredDiscoveryRESTMapper
 	converter       runtime.UnstructuredConverter
 }
 
-func (uc *UnstructuredClient) Get(ctx context.Context, name string, opts Options) (*unstructured.Unstructured, error) {
-	ri, err := uc.resourceInterfaceFor(opts)
+// RESTConfig returns the configuration this client has been created with.
+func (uc *UnstructuredClient) RESTConfig() *rest.Config {
+	return uc.rc
+}
+
+func (uc *UnstructuredClient) Get(ctx context.Context, name string, opts Options) (res *unstructured.Unstructured, err error) {
+	ctx, span := startSpan(ctx, "Get", opts)
+	defer func() { tracing.End(span, err) }()
+
+	ri, err := uc.resourceInterfaceFor(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -77,8 +97,11 @@ func (uc *UnstructuredClient) Get(ctx context.Context, name string, opts Options
 	return ri.Get(ctx, name, metav1.GetOptions{})
 }
 
-func (uc *UnstructuredClient) List(ctx context.Context, opts Options) (*unstructured.UnstructuredList, error) {
-	ri, err := uc.resourceInterfaceFor(opts)
+func (uc *UnstructuredClient) List(ctx context.Context, opts Options) (res *unstructured.UnstructuredList, err error) {
+	ctx, span := startSpan(ctx, "List", opts)
+	defer func() { tracing.End(span, err) }()
+
+	ri, err := uc.resourceInterfaceFor(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -86,8 +109,23 @@ func (uc *UnstructuredClient) List(ctx context.Context, opts Options) (*unstruct
 	return ri.List(ctx, metav1.ListOptions{})
 }
 
-func (uc *UnstructuredClient) Delete(ctx context.Context, name string, opts Options) error {
-	ri, err := uc.resourceInterfaceFor(opts)
+func (uc *UnstructuredClient) Watch(ctx context.Context, lo metav1.ListOptions, opts Options) (res watch.Interface, err error) {
+	ctx, span := startSpan(ctx, "Watch", opts)
+	defer func() { tracing.End(span, err) }()
+
+	ri, err := uc.resourceInterfaceFor(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return ri.Watch(ctx, lo)
+}
+
+func (uc *UnstructuredClient) Delete(ctx context.Context, name string, opts Options) (err error) {
+	ctx, span := startSpan(ctx, "Delete", opts)
+	defer func() { tracing.End(span, err) }()
+
+	ri, err := uc.resourceInterfaceFor(ctx, opts)
 	if err != nil {
 		return err
 	}
@@ -95,8 +133,11 @@ func (uc *UnstructuredClient) Delete(ctx context.Context, name string, opts Opti
 	return ri.Delete(ctx, name, metav1.DeleteOptions{})
 }
 
-func (uc *UnstructuredClient) Create(ctx context.Context, obj *unstructured.Unstructured, opts Options) (*unstructured.Unstructured, error) {
-	ri, err := uc.resourceInterfaceFor(opts)
+func (uc *UnstructuredClient) Create(ctx context.Context, obj *unstructured.Unstructured, opts Options) (res *unstructured.Unstructured, err error) {
+	ctx, span := startSpan(ctx, "Create", opts)
+	defer func() { tracing.End(span, err) }()
+
+	ri, err := uc.resourceInterfaceFor(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -104,8 +145,11 @@ func (uc *UnstructuredClient) Create(ctx context.Context, obj *unstructured.Unst
 	return ri.Create(ctx, obj, metav1.CreateOptions{})
 }
 
-func (uc *UnstructuredClient) Update(ctx context.Context, obj *unstructured.Unstructured, opts Options) (*unstructured.Unstructured, error) {
-	ri, err := uc.resourceInterfaceFor(opts)
+func (uc *UnstructuredClient) Update(ctx context.Context, obj *unstructured.Unstructured, opts Options) (res *unstructured.Unstructured, err error) {
+	ctx, span := startSpan(ctx, "Update", opts)
+	defer func() { tracing.End(span, err) }()
+
+	ri, err := uc.resourceInterfaceFor(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +157,10 @@ func (uc *UnstructuredClient) Update(ctx context.Context, obj *unstructured.Unst
 	return ri.Update(ctx, obj, metav1.UpdateOptions{})
 }
 
-func (uc *UnstructuredClient) Apply(ctx context.Context, obj *unstructured.Unstructured, opts Options) (*unstructured.Unstructured, error) {
+func (uc *UnstructuredClient) Apply(ctx context.Context, obj *unstructured.Unstructured, opts Options) (res *unstructured.Unstructured, err error) {
+	ctx, span := startSpan(ctx, "Apply", opts)
+	defer func() { tracing.End(span, err) }()
+
 	name, found, err := unstructured.NestedString(obj.Object, "metadata", "name")
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract name from object: %w", err)
@@ -156,6 +203,10 @@ func (uc *UnstructuredClient) Convert(in map[string]any, out any) error {
 }
 
 func (uc *UnstructuredClient) Discover(ctx context.Context, category string) (all []schema.GroupVersionResource, err error) {
+	_, span := tracing.Start(ctx, "dynamic.Discover",
+		trace.WithAttributes(attribute.String("k8s.category", category)))
+	defer func() { tracing.End(span, err) }()
+
 	lists, err := uc.discoveryClient.ServerPreferredResources()
 	if err != nil {
 		return
@@ -182,6 +233,49 @@ func (uc *UnstructuredClient) Discover(ctx context.Context, category string) (al
 	return
 }
 
+// DiscoverResources returns the preferred version of the resources in a
+// category and in an API group; an empty category or group matches any.
+func (uc *UnstructuredClient) DiscoverResources(ctx context.Context, category, group string) (all []schema.GroupVersionResource, err error) {
+	_, span := tracing.Start(ctx, "dynamic.DiscoverResources", trace.WithAttributes(
+		attribute.String("k8s.category", category),
+		attribute.String("k8s.group", group),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	// Groups failing discovery (i.e. an unavailable aggregated API) are skipped.
+	lists, err := uc.discoveryClient.ServerPreferredResources()
+	if err != nil && len(lists) == 0 {
+		return nil, err
+	}
+
+	return filterResources(lists, category, group), nil
+}
+
+// filterResources returns the resources in a category and in an API group.
+func filterResources(lists []*metav1.APIResourceList, category, group string) []schema.GroupVersionResource {
+	var all []schema.GroupVersionResource
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil || (len(group) > 0 && gv.Group != group) {
+			continue
+		}
+
+		for _, el := range list.APIResources {
+			// Subresources (i.e. 'widgets/status') are not resources.
+			if strings.Contains(el.Name, "/") {
+				continue
+			}
+			if len(category) > 0 && !contains(el.Categories, category) {
+				continue
+			}
+
+			all = append(all, gv.WithResource(el.Name))
+		}
+	}
+
+	return all
+}
+
 func (uc *UnstructuredClient) YAMLBytesToUnstructured(yamlBytes []byte) (*unstructured.Unstructured, error) {
 	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(yamlBytes), 4096)
 
@@ -193,7 +287,38 @@ func (uc *UnstructuredClient) YAMLBytesToUnstructured(yamlBytes []byte) (*unstru
 	return &unstructured.Unstructured{Object: obj}, nil
 }
 
-func (uc *UnstructuredClient) resourceInterfaceFor(opts Options) (dynamic.ResourceInterface, error) {
+// ResetMapper drops the cached API discovery, so that kinds and resources
+// created after the first lookup (e.g. a just forged widget) can be resolved.
+// The discovery may be shared by many clients, so the resets are throttled
+// (see DefaultResetInterval): call it only when the served kinds changed.
+func (uc *UnstructuredClient) ResetMapper() {
+	uc.discovery.Invalidate()
+}
+
+// ResourceFor resolves the resource of the specified kind using the client
+// (shared) discovery; with an empty version the preferred one is used.
+func (uc *UnstructuredClient) ResourceFor(gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	var versions []string
+	if len(gvk.Version) > 0 {
+		versions = append(versions, gvk.Version)
+	}
+
+	mapping, err := uc.mapper.RESTMapping(gvk.GroupKind(), versions...)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+
+	return mapping.Resource, nil
+}
+
+func (uc *UnstructuredClient) resourceInterfaceFor(ctx context.Context, opts Options) (ri dynamic.ResourceInterface, err error) {
+	_, span := tracing.Start(ctx, "dynamic.ResolveResource")
+	defer func() { tracing.End(span, err) }()
+
+	return uc.resolveResourceInterface(opts)
+}
+
+func (uc *UnstructuredClient) resolveResourceInterface(opts Options) (dynamic.ResourceInterface, error) {
 	if opts.GVK.Empty() && !opts.GVR.Empty() {
 		gvk, err := uc.mapper.KindFor(opts.GVR)
 		if err != nil {
@@ -217,6 +342,19 @@ func (uc *UnstructuredClient) resourceInterfaceFor(opts Options) (dynamic.Resour
 	return ri, nil
 }
 
+// startSpan traces a client call on the resource selected by opts.
+func startSpan(ctx context.Context, verb string, opts Options) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("k8s.namespace", opts.Namespace)}
+	if !opts.GVR.Empty() {
+		attrs = append(attrs, attribute.String("k8s.resource", opts.GVR.String()))
+	}
+	if !opts.GVK.Empty() {
+		attrs = append(attrs, attribute.String("k8s.kind", opts.GVK.String()))
+	}
+
+	return tracing.Start(ctx, "dynamic."+verb, trace.WithAttributes(attrs...))
+}
+
 func found(el metav1.APIResource, str string) bool {
 	if strings.EqualFold(el.Name, str) {
 		return true
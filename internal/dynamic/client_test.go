@@ -67,6 +67,17 @@ func TestDynamicClient(t *testing.T) {
 
 			return ctx
 		}).
+		Assess("ResourceFor", func(ctx context.Context, t *testing.T, c *envconf.Config) context.Context {
+			cli, err := NewClient(c.Client().RESTConfig())
+			assert.Nil(t, err)
+			assert.NotNil(t, cli)
+
+			got, err := cli.ResourceFor(schema.GroupVersionKind{Group: "apps", Kind: "Deployment"})
+			assert.Nil(t, err)
+			assert.Equal(t, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, got)
+
+			return ctx
+		}).
 		Feature()
 
 	testenv.Test(t, f)
@@ -0,0 +1,75 @@
+package dynamic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFilterResources(t *testing.T) {
+	lists := []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps"},
+				{Name: "pods", Categories: []string{"all"}},
+				{Name: "pods/status"},
+			},
+		},
+		{
+			GroupVersion: "widgets.templates.krateo.io/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "buttons", Categories: []string{"widgets", "krateo"}},
+				{Name: "buttons/status", Categories: []string{"widgets", "krateo"}},
+				{Name: "panels", Categories: []string{"widgets", "krateo"}},
+			},
+		},
+		{
+			GroupVersion: "composition.krateo.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "fireworksapps", Categories: []string{"krateo"}},
+			},
+		},
+	}
+
+	widgets := schema.GroupVersion{Group: "widgets.templates.krateo.io", Version: "v1beta1"}
+
+	tests := []struct {
+		name     string
+		category string
+		group    string
+		want     []schema.GroupVersionResource
+	}{
+		{
+			name:     "by category",
+			category: "widgets",
+			want:     []schema.GroupVersionResource{widgets.WithResource("buttons"), widgets.WithResource("panels")},
+		},
+		{
+			name:  "by group",
+			group: "composition.krateo.io",
+			want: []schema.GroupVersionResource{
+				{Group: "composition.krateo.io", Version: "v1", Resource: "fireworksapps"},
+			},
+		},
+		{
+			name:     "by category and group",
+			category: "krateo",
+			group:    "widgets.templates.krateo.io",
+			want:     []schema.GroupVersionResource{widgets.WithResource("buttons"), widgets.WithResource("panels")},
+		},
+		{
+			name:     "nothing matches",
+			category: "widgets",
+			group:    "composition.krateo.io",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, filterResources(lists, tc.category, tc.group))
+		})
+	}
+}
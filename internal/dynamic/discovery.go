@@ -0,0 +1,82 @@
+package dynamic
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	cacheddiscovery "k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// DefaultResetInterval is the minimum time between two invalidations of a
+// cached discovery.
+const DefaultResetInterval = 10 * time.Second
+
+// cachedDiscovery is an API discovery cache, with its REST mapper, that may be
+// shared by many clients. Its invalidations are throttled: at most one for
+// each interval, the ones asked within the interval are coalesced into one at
+// its end, so that no caller can force repeated full API discoveries.
+type cachedDiscovery struct {
+	client   discovery.CachedDiscoveryInterface
+	mapper   *restmapper.DeferredDiscoveryRESTMapper
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	pending bool
+
+	// now and after are replaced by tests.
+	now   func() time.Time
+	after func(time.Duration, func())
+}
+
+func newCachedDiscovery(dc discovery.DiscoveryInterface, interval time.Duration) *cachedDiscovery {
+	if interval <= 0 {
+		interval = DefaultResetInterval
+	}
+
+	client := cacheddiscovery.NewMemCacheClient(dc)
+
+	return &cachedDiscovery{
+		client:   client,
+		mapper:   restmapper.NewDeferredDiscoveryRESTMapper(client),
+		interval: interval,
+		now:      time.Now,
+		after: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+// Invalidate drops the cached discovery now or, when it has been dropped less
+// than an interval ago, at the end of the interval.
+func (c *cachedDiscovery) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending {
+		return
+	}
+
+	wait := c.interval - c.now().Sub(c.last)
+	if wait <= 0 {
+		c.reset()
+		return
+	}
+
+	c.pending = true
+	c.after(wait, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.pending = false
+		c.reset()
+	})
+}
+
+// reset must be called with the lock held.
+func (c *cachedDiscovery) reset() {
+	c.last = c.now()
+	c.mapper.Reset()
+}
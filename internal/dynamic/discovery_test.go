@@ -0,0 +1,53 @@
+package dynamic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCachedDiscoveryInvalidate(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var scheduled []func()
+	fake := &k8stesting.Fake{Resources: []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}},
+	}}}
+	dc := newCachedDiscovery(&fakediscovery.FakeDiscovery{Fake: fake}, 10*time.Second)
+	dc.now = func() time.Time { return now }
+	dc.after = func(_ time.Duration, f func()) { scheduled = append(scheduled, f) }
+
+	// fill populates the cache, so that Fresh tells whether it has been invalidated since.
+	fill := func() {
+		_, err := dc.client.ServerGroups()
+		require.NoError(t, err)
+		require.True(t, dc.client.Fresh())
+	}
+
+	fill()
+	dc.Invalidate()
+	assert.False(t, dc.client.Fresh(), "the first invalidation is immediate")
+
+	fill()
+	now = now.Add(time.Second)
+	dc.Invalidate()
+	dc.Invalidate()
+	assert.True(t, dc.client.Fresh(), "invalidations within the interval are deferred")
+	require.Len(t, scheduled, 1, "deferred invalidations are coalesced")
+
+	now = now.Add(9 * time.Second)
+	scheduled[0]()
+	assert.False(t, dc.client.Fresh())
+
+	fill()
+	now = now.Add(10 * time.Second)
+	dc.Invalidate()
+	assert.False(t, dc.client.Fresh())
+	assert.Len(t, scheduled, 1)
+}
@@ -3,6 +3,7 @@ package dynamic
 import (
 	"strings"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -34,6 +35,10 @@ func ResourceFor(rc *rest.Config, gvk schema.GroupVersionKind) (schema.GroupVers
 	)
 
 	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		mapper.Reset()
+		mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
 	if err != nil {
 		return schema.GroupVersionResource{}, err
 	}
@@ -52,6 +57,10 @@ func KindFor(rc *rest.Config, gvr schema.GroupVersionResource) (gvk schema.Group
 	)
 
 	gvk, err = mapper.KindFor(gvr)
+	if meta.IsNoMatchError(err) {
+		mapper.Reset()
+		gvk, err = mapper.KindFor(gvr)
+	}
 
 	return
 }
@@ -0,0 +1,145 @@
+package dynamic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/cache"
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/endpoints"
+	"github.com/krateoplatformops/plumbing/kubeconfig"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	DefaultPoolTTL = 5 * time.Minute
+)
+
+type PoolOptions struct {
+	// TTL is how long an unused client is kept in the pool.
+	TTL time.Duration
+	// QPS and Burst configure the client side rate limiter of every
+	// pooled client; zero values keep the client-go defaults.
+	QPS   float32
+	Burst int
+	// DiscoveryConfig, when set, is used to build a single cached discovery
+	// shared by all the pooled clients (API discovery is the same for every
+	// user, only the subsequent calls are subject to authorization).
+	DiscoveryConfig *rest.Config
+	// ResetInterval is the minimum time between two invalidations of the
+	// shared discovery (DefaultResetInterval when zero).
+	ResetInterval time.Duration
+}
+
+// Pool keeps the clients built from user endpoints,
+// so that a request does not pay for a full API discovery.
+type Pool struct {
+	opts      PoolOptions
+	clients   *cache.TTLCache[string, *UnstructuredClient]
+	discovery *cachedDiscovery
+	mu        sync.Mutex
+}
+
+func NewPool(opts PoolOptions) (*Pool, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultPoolTTL
+	}
+
+	p := &Pool{
+		opts:    opts,
+		clients: cache.NewTTL[string, *UnstructuredClient](),
+	}
+
+	if opts.DiscoveryConfig != nil {
+		dc, err := discovery.NewDiscoveryClientForConfig(withLimits(opts.DiscoveryConfig, opts))
+		if err != nil {
+			return nil, err
+		}
+		p.discovery = newCachedDiscovery(dc, opts.ResetInterval)
+	}
+
+	return p, nil
+}
+
+// ClientFor returns the client for the specified user endpoint,
+// creating it on the first call. A nil *Pool always creates a new client.
+func (p *Pool) ClientFor(ctx context.Context, ep endpoints.Endpoint) (*UnstructuredClient, error) {
+	if p == nil {
+		rc, err := kubeconfig.NewClientConfig(ctx, ep)
+		if err != nil {
+			return nil, err
+		}
+		return NewClient(rc)
+	}
+
+	key := poolKey(ctx, ep)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cli, ok := p.clients.Get(key); ok {
+		p.clients.Set(key, cli, p.opts.TTL)
+		return cli, nil
+	}
+
+	rc, err := kubeconfig.NewClientConfig(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+	rc = withLimits(rc, p.opts)
+
+	var cli *UnstructuredClient
+	if p.discovery != nil {
+		cli, err = newClient(rc, p.discovery)
+	} else {
+		cli, err = NewClient(rc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.clients.Set(key, cli, p.opts.TTL)
+
+	return cli, nil
+}
+
+// Len returns the number of pooled clients.
+func (p *Pool) Len() int {
+	return len(p.clients.Keys())
+}
+
+func withLimits(rc *rest.Config, opts PoolOptions) *rest.Config {
+	rc = rest.CopyConfig(rc)
+	if opts.QPS > 0 {
+		rc.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		rc.Burst = opts.Burst
+	}
+	return rc
+}
+
+// poolKey identifies a client by user name, API server and credentials,
+// so that rotated credentials never reuse a stale client.
+func poolKey(ctx context.Context, ep endpoints.Endpoint) string {
+	user := ep.Username
+	if ui, err := xcontext.UserInfo(ctx); err == nil && len(ui.Username) > 0 {
+		user = ui.Username
+	}
+
+	h := sha256.New()
+	for _, s := range []string{
+		ep.ServerURL, ep.ProxyURL, ep.CertificateAuthorityData,
+		ep.ClientCertificateData, ep.ClientKeyData,
+		ep.Token, ep.Username, ep.Password,
+	} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	return user + "@" + ep.ServerURL + "#" + hex.EncodeToString(h.Sum(nil))
+}
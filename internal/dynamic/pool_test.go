@@ -0,0 +1,69 @@
+package dynamic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/endpoints"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+)
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+
+	alice := endpoints.Endpoint{
+		ServerURL: "https://127.0.0.1:6443",
+		Token:     "alice-token",
+		Insecure:  true,
+	}
+
+	pool, err := NewPool(PoolOptions{
+		TTL:             time.Minute,
+		QPS:             42,
+		Burst:           84,
+		DiscoveryConfig: &rest.Config{Host: "https://127.0.0.1:6443"},
+	})
+	require.NoError(t, err)
+
+	t.Run("same endpoint reuses the client", func(t *testing.T) {
+		c1, err := pool.ClientFor(ctx, alice)
+		require.NoError(t, err)
+
+		c2, err := pool.ClientFor(ctx, alice)
+		require.NoError(t, err)
+
+		assert.Same(t, c1, c2)
+		assert.Equal(t, float32(42), c1.RESTConfig().QPS)
+		assert.Equal(t, 84, c1.RESTConfig().Burst)
+		assert.Equal(t, 1, pool.Len())
+	})
+
+	t.Run("rotated credentials get a new client", func(t *testing.T) {
+		c1, err := pool.ClientFor(ctx, alice)
+		require.NoError(t, err)
+
+		rotated := alice
+		rotated.Token = "alice-new-token"
+		c2, err := pool.ClientFor(ctx, rotated)
+		require.NoError(t, err)
+
+		assert.NotSame(t, c1, c2)
+		assert.Same(t, c1.discoveryClient, c2.discoveryClient)
+		assert.Same(t, c1.mapper, c2.mapper)
+		assert.Equal(t, 2, pool.Len())
+	})
+
+	t.Run("nil pool", func(t *testing.T) {
+		var nilPool *Pool
+
+		c1, err := nilPool.ClientFor(ctx, alice)
+		require.NoError(t, err)
+		c2, err := nilPool.ClientFor(ctx, alice)
+		require.NoError(t, err)
+
+		assert.NotSame(t, c1, c2)
+	})
+}
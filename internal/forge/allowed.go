@@ -0,0 +1,196 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// SelectorKeyword, set on the widgetData.allowedResources property of the
+	// input JSON Schema, asks to derive the allowed resources from the API discovery:
+	//
+	//	"allowedResources": {
+	//	  "type": "string",
+	//	  "x-krateo-allowed-resources": {"category": "widgets"}
+	//	}
+	SelectorKeyword = "x-krateo-allowed-resources"
+
+	// AnnotationAllowedResources, set on the forged CRDs, is the JSON encoded
+	// selector their allowed resources are derived from.
+	AnnotationAllowedResources = "smithery.krateo.io/allowed-resources"
+)
+
+var (
+	// allowedResourcesPath is where the allowed resources are declared in the input JSON Schema.
+	allowedResourcesPath = []string{"properties", "spec", "properties", "widgetData", "properties", "allowedResources"}
+
+	// enumPaths are, in the spec schema, the properties restricted to the allowed resources.
+	enumPaths = [][]string{
+		{"properties", "widgetData", "properties", "allowedResources"},
+		{"properties", "resourcesRefs", "properties", "items", "items", "properties", "resource"},
+	}
+)
+
+// ResourceSelector selects the allowed resources among the ones served by the
+// cluster: the resources in Category and/or in Group.
+type ResourceSelector struct {
+	Category string `json:"category,omitempty"`
+	Group    string `json:"group,omitempty"`
+}
+
+// DiscoverFunc returns the resources served by the cluster in a category
+// and/or in an API group, an empty value matches any.
+type DiscoverFunc func(ctx context.Context, category, group string) ([]schema.GroupVersionResource, error)
+
+// Resolve returns, sorted and without duplicates, the names of the resources
+// matching the selector.
+func (s ResourceSelector) Resolve(ctx context.Context, discover DiscoverFunc) ([]string, error) {
+	all, err := discover(ctx, s.Category, s.Group)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover the allowed resources: %w", err)
+	}
+
+	res := make([]string, 0, len(all))
+	for _, el := range all {
+		res = append(res, el.Resource)
+	}
+	slices.Sort(res)
+
+	return slices.Compact(res), nil
+}
+
+// String returns the selector as stored in the AnnotationAllowedResources annotation.
+func (s ResourceSelector) String() string {
+	dat, _ := json.Marshal(s)
+	return string(dat)
+}
+
+// extractSelector removes the SelectorKeyword from the input JSON Schema,
+// returning the selector, if any.
+func extractSelector(src map[string]any) (*ResourceSelector, error) {
+	allowed, ok, _ := unstructured.NestedMap(src, allowedResourcesPath...)
+	if !ok {
+		return nil, nil
+	}
+
+	val, ok := allowed[SelectorKeyword]
+	if !ok {
+		return nil, nil
+	}
+
+	dat, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var sel ResourceSelector
+	if err := json.Unmarshal(dat, &sel); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SelectorKeyword, err)
+	}
+	if len(sel.Category) == 0 && len(sel.Group) == 0 {
+		return nil, fmt.Errorf("invalid %s: category or group is required", SelectorKeyword)
+	}
+	if _, ok := allowed["enum"]; ok {
+		return nil, fmt.Errorf("%s and enum are mutually exclusive", SelectorKeyword)
+	}
+
+	// Unknown keywords are not accepted in CRD schemas.
+	delete(allowed, SelectorKeyword)
+	if err := unstructured.SetNestedMap(src, allowed, allowedResourcesPath...); err != nil {
+		return nil, err
+	}
+
+	return &sel, nil
+}
+
+// SelectorOf returns the selector the allowed resources of a forged CRD are
+// derived from, nil when they are fixed.
+func SelectorOf(crd map[string]any) (*ResourceSelector, error) {
+	val, ok, _ := unstructured.NestedString(crd, "metadata", "annotations", AnnotationAllowedResources)
+	if !ok {
+		return nil, nil
+	}
+
+	var sel ResourceSelector
+	if err := json.Unmarshal([]byte(val), &sel); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", AnnotationAllowedResources, err)
+	}
+	return &sel, nil
+}
+
+// SetAllowedResources restricts, in all the versions of a forged CRD, the
+// widgetData.allowedResources and resourcesRefs.items[].resource properties
+// to the specified resources (any resource when empty).
+// It reports whether the CRD has been changed.
+func SetAllowedResources(crd map[string]any, resources []string) (bool, error) {
+	versions, _, err := unstructured.NestedSlice(crd, "spec", "versions")
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for i, el := range versions {
+		ver, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		spec, ok, _ := unstructured.NestedMap(ver, "schema", "openAPIV3Schema", "properties", "spec")
+		if !ok {
+			continue
+		}
+
+		if setEnums(spec, resources) {
+			if err := unstructured.SetNestedMap(ver, spec, "schema", "openAPIV3Schema", "properties", "spec"); err != nil {
+				return false, err
+			}
+			versions[i], changed = ver, true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	return true, unstructured.SetNestedSlice(crd, versions, "spec", "versions")
+}
+
+// setEnums restricts the allowed resources properties of a spec schema
+// to the specified resources, reporting whether it has been changed.
+func setEnums(spec map[string]any, resources []string) bool {
+	enum := make([]any, 0, len(resources))
+	for _, el := range resources {
+		enum = append(enum, el)
+	}
+
+	changed := false
+	for _, path := range enumPaths {
+		prop, ok, _ := unstructured.NestedFieldNoCopy(spec, path...)
+		if !ok {
+			continue
+		}
+		obj, ok := prop.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		cur, _ := obj["enum"].([]any)
+		if slices.Equal(cur, enum) {
+			continue
+		}
+
+		if len(enum) == 0 {
+			delete(obj, "enum")
+		} else {
+			obj["enum"] = enum
+		}
+		changed = true
+	}
+
+	return changed
+}
@@ -0,0 +1,102 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// buttonWithSelector returns the button JSON Schema with the allowed resources
+// derived from the specified selector.
+func buttonWithSelector(t *testing.T, sel map[string]any) map[string]any {
+	t.Helper()
+
+	dat, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	src := map[string]any{}
+	require.NoError(t, json.Unmarshal(dat, &src))
+
+	require.NoError(t, unstructured.SetNestedMap(src, map[string]any{
+		"type":          "string",
+		SelectorKeyword: sel,
+	}, allowedResourcesPath...))
+
+	return src
+}
+
+func discoverWidgets(_ context.Context, category, group string) ([]schema.GroupVersionResource, error) {
+	if category != "widgets" || group != "" {
+		return nil, errors.New("unexpected selector")
+	}
+
+	gv := schema.GroupVersion{Group: DefaultGroup, Version: "v1beta1"}
+	return []schema.GroupVersionResource{
+		gv.WithResource("panels"),
+		gv.WithResource("buttons"),
+		gv.WithResource("buttons"),
+	}, nil
+}
+
+func TestParseSelector(t *testing.T) {
+	src := buttonWithSelector(t, map[string]any{"category": "widgets"})
+
+	w, err := Parse(src)
+	require.NoError(t, err)
+	require.NotNil(t, w.Selector)
+	assert.Equal(t, ResourceSelector{Category: "widgets"}, *w.Selector)
+	assert.NotContains(t, string(w.Spec), SelectorKeyword)
+
+	// The input schema is left untouched.
+	_, ok, _ := unstructured.NestedMap(src, append(allowedResourcesPath, SelectorKeyword)...)
+	assert.True(t, ok)
+
+	_, err = Parse(buttonWithSelector(t, map[string]any{}))
+	assert.ErrorContains(t, err, "category or group is required")
+}
+
+func TestExpandAllowedResources(t *testing.T) {
+	w, err := Parse(buttonWithSelector(t, map[string]any{"category": "widgets"}))
+	require.NoError(t, err)
+
+	require.NoError(t, w.ExpandAllowedResources(context.Background(), discoverWidgets))
+
+	spec := map[string]any{}
+	require.NoError(t, json.Unmarshal(w.Spec, &spec))
+	for _, path := range enumPaths {
+		got, _, _ := unstructured.NestedSlice(spec, append(path, "enum")...)
+		assert.Equal(t, []any{"buttons", "panels"}, got)
+	}
+
+	res, err := Generate(DefaultGroup, w)
+	require.NoError(t, err)
+
+	crd := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(res, &crd))
+
+	sel, err := SelectorOf(crd)
+	require.NoError(t, err)
+	assert.Equal(t, &ResourceSelector{Category: "widgets"}, sel)
+
+	changed, err := SetAllowedResources(crd, []string{"buttons", "panels"})
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = SetAllowedResources(crd, []string{"buttons", "panels", "tables"})
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	versions, _, _ := unstructured.NestedSlice(crd, "spec", "versions")
+	require.Len(t, versions, 1)
+	got, _, _ := unstructured.NestedSlice(versions[0].(map[string]any), "schema", "openAPIV3Schema",
+		"properties", "spec", "properties", "resourcesRefs", "properties", "items", "items", "properties", "resource", "enum")
+	assert.Equal(t, []any{"buttons", "panels", "tables"}, got)
+}
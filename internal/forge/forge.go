@@ -0,0 +1,148 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gobuffalo/flect"
+	"github.com/krateoplatformops/crdgen/v2"
+	"github.com/krateoplatformops/krateoctl/jsonschema"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultGroup is the API group of the forged widgets.
+	DefaultGroup = "widgets.templates.krateo.io"
+
+	preserveUnknownFields = `{"type": "object", "additionalProperties": true,"x-kubernetes-preserve-unknown-fields": true}`
+)
+
+// Widget is a widget JSON Schema ready to be forged into a CRD.
+type Widget struct {
+	Kind    string
+	Version string
+	// Spec is the JSON Schema of the CRD spec, with the allowed resources injected.
+	Spec []byte
+	// Selector, when set, derives the allowed resources from the API discovery
+	// (see ExpandAllowedResources) instead of a fixed enum.
+	Selector *ResourceSelector
+}
+
+// Parse extracts the kind, the version and the spec (with the allowed
+// resources injected) from a widget JSON Schema.
+func Parse(src map[string]any) (Widget, error) {
+	src = runtime.DeepCopyJSON(src)
+
+	kind, version, err := jsonschema.ExtractKindAndVersion(src)
+	if err != nil {
+		return Widget{}, fmt.Errorf("unable to extract kind and version from JSON Schema: %w", err)
+	}
+
+	sel, err := extractSelector(src)
+	if err != nil {
+		return Widget{}, fmt.Errorf("unable to extract allowedResources selector from JSON Schema: %w", err)
+	}
+
+	allowedResources, err := jsonschema.ExtractAllowedResources(src)
+	if err != nil {
+		return Widget{}, fmt.Errorf("unable to extract allowedResources from JSON Schema: %w", err)
+	}
+
+	obj, err := jsonschema.ExtractSpec(src)
+	if err != nil {
+		return Widget{}, fmt.Errorf("unable to extract spec from JSON Schema: %w", err)
+	}
+
+	if len(allowedResources) > 0 {
+		err = jsonschema.SetAllowedResources(obj, allowedResources)
+		if err != nil {
+			return Widget{}, fmt.Errorf("unable to inject allowed resources into JSON Schema: %w", err)
+		}
+	}
+
+	spec, err := json.Marshal(obj)
+	if err != nil {
+		return Widget{}, fmt.Errorf("unable to convert extracted spec to JSON: %w", err)
+	}
+
+	return Widget{
+		Kind:     kind,
+		Version:  version,
+		Spec:     spec,
+		Selector: sel,
+	}, nil
+}
+
+// ExpandAllowedResources restricts the allowed resources of a widget with a
+// selector to the ones currently returned by discover.
+func (w *Widget) ExpandAllowedResources(ctx context.Context, discover DiscoverFunc) error {
+	if w.Selector == nil {
+		return nil
+	}
+
+	resources, err := w.Selector.Resolve(ctx, discover)
+	if err != nil {
+		return err
+	}
+
+	spec := map[string]any{}
+	if err := json.Unmarshal(w.Spec, &spec); err != nil {
+		return err
+	}
+
+	if !setEnums(spec, resources) {
+		return nil
+	}
+
+	w.Spec, err = json.Marshal(spec)
+	return err
+}
+
+// ParseJSON is like Parse, for an encoded widget JSON Schema.
+func ParseJSON(data []byte) (Widget, error) {
+	src := map[string]any{}
+	if err := json.Unmarshal(data, &src); err != nil {
+		return Widget{}, err
+	}
+
+	return Parse(src)
+}
+
+// CRDName returns the name of the CRD generated for a widget kind in the
+// specified group, pluralized like controller-gen does for crdgen.
+func CRDName(group, kind string) string {
+	return strings.ToLower(flect.Pluralize(kind)) + "." + group
+}
+
+// Generate returns the YAML of the CRD of the widget in the specified group.
+// The CRDs of widgets with a selector are annotated with it, so that their
+// allowed resources can be refreshed.
+func Generate(group string, w Widget) ([]byte, error) {
+	res, err := crdgen.Generate(crdgen.Options{
+		Group:        group,
+		Version:      w.Version,
+		Kind:         w.Kind,
+		Categories:   []string{"widgets", "krateo"},
+		SpecSchema:   w.Spec,
+		StatusSchema: []byte(preserveUnknownFields),
+	})
+	if err != nil || w.Selector == nil {
+		return res, err
+	}
+
+	crd := map[string]any{}
+	if err := yaml.Unmarshal(res, &crd); err != nil {
+		return nil, err
+	}
+
+	err = unstructured.SetNestedField(crd, w.Selector.String(), "metadata", "annotations", AnnotationAllowedResources)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(crd)
+}
@@ -0,0 +1,61 @@
+package forge
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestParseAndGenerate(t *testing.T) {
+	dat, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	w, err := ParseJSON(dat)
+	require.NoError(t, err)
+	assert.Equal(t, "Button", w.Kind)
+	assert.Equal(t, "v1beta1", w.Version)
+	assert.NotEmpty(t, w.Spec)
+
+	res, err := Generate(DefaultGroup, w)
+	require.NoError(t, err)
+
+	var crd apiextensionsv1.CustomResourceDefinition
+	require.NoError(t, yaml.Unmarshal(res, &crd))
+	assert.Equal(t, "buttons.widgets.templates.krateo.io", crd.Name)
+	assert.Equal(t, DefaultGroup, crd.Spec.Group)
+	assert.Equal(t, []string{"widgets", "krateo"}, crd.Spec.Names.Categories)
+	require.Len(t, crd.Spec.Versions, 1)
+	assert.Equal(t, "v1beta1", crd.Spec.Versions[0].Name)
+}
+
+func TestCRDName(t *testing.T) {
+	dat, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	w, err := ParseJSON(dat)
+	require.NoError(t, err)
+
+	// Irregular plurals must match the ones of the generated CRDs.
+	for _, kind := range []string{"Button", "Box", "Person"} {
+		w.Kind = kind
+
+		res, err := Generate(DefaultGroup, w)
+		require.NoError(t, err)
+
+		var crd apiextensionsv1.CustomResourceDefinition
+		require.NoError(t, yaml.Unmarshal(res, &crd))
+		assert.Equal(t, crd.Name, CRDName(DefaultGroup, kind))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := ParseJSON([]byte(`{`))
+	assert.Error(t, err)
+
+	_, err = ParseJSON([]byte(`{"type": "object"}`))
+	assert.ErrorContains(t, err, "unable to extract kind and version")
+}
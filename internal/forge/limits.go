@@ -0,0 +1,76 @@
+package forge
+
+import (
+	"fmt"
+)
+
+// Limits bounds the size of the input JSON Schemas, a zero value disables a limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting of the sub-schemas.
+	MaxDepth int
+	// MaxProperties is the maximum number of properties, at any level.
+	MaxProperties int
+}
+
+// LimitError is returned when a JSON Schema exceeds a limit.
+type LimitError struct {
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("JSON Schema exceeds the maximum %s of %d", e.Limit, e.Max)
+}
+
+// subSchemasKeywords are the keywords whose values are maps of sub-schemas.
+var subSchemasKeywords = []string{"properties", "patternProperties", "definitions", "$defs"}
+
+// Check returns a *LimitError when the JSON Schema exceeds the limits.
+func (l Limits) Check(src map[string]any) error {
+	props := 0
+	return l.walk(src, 1, &props)
+}
+
+func (l Limits) walk(node map[string]any, depth int, props *int) error {
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &LimitError{Limit: "depth", Max: l.MaxDepth}
+	}
+
+	var children []any
+	for _, key := range subSchemasKeywords {
+		m, _ := node[key].(map[string]any)
+		if key == "properties" {
+			*props += len(m)
+			if l.MaxProperties > 0 && *props > l.MaxProperties {
+				return &LimitError{Limit: "number of properties", Max: l.MaxProperties}
+			}
+		}
+		for _, el := range m {
+			children = append(children, el)
+		}
+	}
+
+	for _, key := range []string{"items", "additionalProperties", "not"} {
+		children = append(children, node[key])
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		list, _ := node[key].([]any)
+		children = append(children, list...)
+	}
+	// Tuple validation (items as a list of schemas).
+	if list, ok := node["items"].([]any); ok {
+		children = append(children, list...)
+	}
+
+	for _, el := range children {
+		sub, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := l.walk(sub, depth+1, props); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
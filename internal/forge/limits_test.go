@@ -0,0 +1,37 @@
+package forge
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	dat, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	src := map[string]any{}
+	require.NoError(t, json.Unmarshal(dat, &src))
+
+	assert.NoError(t, Limits{}.Check(src))
+	assert.NoError(t, Limits{MaxDepth: 32, MaxProperties: 1000}.Check(src))
+
+	err = Limits{MaxDepth: 3}.Check(src)
+	assert.EqualError(t, err, "JSON Schema exceeds the maximum depth of 3")
+
+	err = Limits{MaxProperties: 5}.Check(src)
+	var le *LimitError
+	require.ErrorAs(t, err, &le)
+	assert.Equal(t, "number of properties", le.Limit)
+
+	nested := map[string]any{"type": "array", "items": map[string]any{
+		"anyOf": []any{map[string]any{"type": "object", "properties": map[string]any{
+			"a": map[string]any{"type": "string"},
+		}}},
+	}}
+	assert.NoError(t, Limits{MaxDepth: 4}.Check(nested))
+	assert.Error(t, Limits{MaxDepth: 3}.Check(nested))
+}
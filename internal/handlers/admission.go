@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/widgets"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// maxAdmissionReviewSize is the largest AdmissionReview accepted (the API server sends at most 3MB objects).
+const maxAdmissionReviewSize = 6 << 20
+
+// crdGetter returns the custom resource definition with the specified name.
+type crdGetter func(ctx context.Context, name string) (map[string]any, error)
+
+// Admission serves the validating webhook of the widgets custom resources.
+// It rejects the widgets whose widgetDataTemplate and resourcesRefs break the
+// Krateo semantics that the CRD OpenAPI schema cannot express.
+// The CRDs are read from the cache, when ready, otherwise with the service account.
+func Admission(store *crds.Cache, rc *rest.Config) http.Handler {
+	return &admissionHandler{
+		getCRD: func(ctx context.Context, name string) (map[string]any, error) {
+			if store.Ready() {
+				if crd, ok := store.Get(name); ok {
+					return crd, nil
+				}
+			}
+
+			return crds.Get(ctx, crds.GetOptions{RC: rc, Name: name})
+		},
+	}
+}
+
+var _ http.Handler = (*admissionHandler)(nil)
+
+type admissionHandler struct {
+	getCRD crdGetter
+}
+
+func (r *admissionHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	log := xcontext.Logger(req.Context())
+
+	var review admissionv1.AdmissionReview
+	err := json.NewDecoder(http.MaxBytesReader(wri, req.Body, maxAdmissionReviewSize)).Decode(&review)
+	if err != nil {
+		response.BadRequest(wri, fmt.Errorf("invalid admission review: %w", err))
+		return
+	}
+	if review.Request == nil {
+		response.BadRequest(wri, fmt.Errorf("admission review without request"))
+		return
+	}
+
+	review.Response = r.review(req.Context(), review.Request)
+	review.Request = nil
+
+	log.Debug("widget admission reviewed",
+		slog.String("uid", string(review.Response.UID)),
+		slog.Bool("allowed", review.Response.Allowed))
+
+	wri.Header().Set("Content-Type", "application/json")
+	wri.WriteHeader(http.StatusOK)
+	json.NewEncoder(wri).Encode(review)
+}
+
+// review validates the widget of the admission request.
+func (r *admissionHandler) review(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	res := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	if req.Kind.Group != WidgetsGroup || len(req.Object.Raw) == 0 {
+		return res
+	}
+
+	log := xcontext.Logger(ctx).With(
+		slog.String("kind", req.Kind.Kind),
+		slog.String("name", req.Name),
+		slog.String("namespace", req.Namespace),
+	)
+
+	name := fmt.Sprintf("%s.%s", req.Resource.Resource, req.Resource.Group)
+	crd, err := r.getCRD(ctx, name)
+	if err != nil {
+		// Failing open: the apiserver already validated the OpenAPI schema.
+		log.Warn("unable to get widget CRD, admission skipped", slog.String("crd", name), slog.Any("err", err))
+		res.Warnings = []string{fmt.Sprintf("smithery: widget semantics not checked: %s", err.Error())}
+		return res
+	}
+
+	schema, err := crds.OpenAPISchema(crd, req.Kind.Version)
+	if err != nil {
+		log.Warn("unable to get widget schema, admission skipped", slog.String("crd", name), slog.Any("err", err))
+		res.Warnings = []string{fmt.Sprintf("smithery: widget semantics not checked: %s", err.Error())}
+		return res
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+		return denied(res, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error(), nil)
+	}
+
+	errs := widgets.Validate(obj, schema)
+	if len(errs) == 0 {
+		return res
+	}
+
+	log.Info("widget rejected", slog.Any("errs", errs.ToAggregate()))
+
+	causes := make([]metav1.StatusCause, 0, len(errs))
+	msgs := make([]string, 0, len(errs))
+	for _, el := range errs {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseType(el.Type),
+			Message: el.ErrorBody(),
+			Field:   el.Field,
+		})
+		msgs = append(msgs, el.Error())
+	}
+
+	msg := fmt.Sprintf("%s %q is invalid: %s", req.Kind.Kind, req.Name, strings.Join(msgs, "; "))
+	return denied(res, http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, msg, causes)
+}
+
+// denied rejects the admission with the specified status.
+func denied(res *admissionv1.AdmissionResponse, code int32, reason metav1.StatusReason, msg string, causes []metav1.StatusCause) *admissionv1.AdmissionResponse {
+	res.Allowed = false
+	res.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  reason,
+		Message: msg,
+	}
+	if len(causes) > 0 {
+		res.Result.Details = &metav1.StatusDetails{Causes: causes}
+	}
+	return res
+}
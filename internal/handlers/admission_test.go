@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/krateoplatformops/smithery/internal/forge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func forgeButtonCRD(t *testing.T) map[string]any {
+	t.Helper()
+
+	dat, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	w, err := forge.ParseJSON(dat)
+	require.NoError(t, err)
+
+	res, err := forge.Generate(forge.DefaultGroup, w)
+	require.NoError(t, err)
+
+	var crd map[string]any
+	require.NoError(t, yaml.Unmarshal(res, &crd))
+	return crd
+}
+
+func serveAdmission(t *testing.T, h http.Handler, review []byte) *admissionv1.AdmissionReview {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/admission", bytes.NewReader(review))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var res admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.NotNil(t, res.Response)
+	return &res
+}
+
+func TestAdmission(t *testing.T) {
+	review, err := os.ReadFile("../../testdata/admissionreview.button.json")
+	require.NoError(t, err)
+
+	crd := forgeButtonCRD(t)
+
+	h := &admissionHandler{getCRD: func(_ context.Context, name string) (map[string]any, error) {
+		assert.Equal(t, "buttons.widgets.templates.krateo.io", name)
+		return crd, nil
+	}}
+
+	t.Run("invalid widget is rejected", func(t *testing.T) {
+		res := serveAdmission(t, h, review)
+
+		assert.Equal(t, "705ab4f5-6393-11e8-b7cc-42010a800002", string(res.Response.UID))
+		assert.False(t, res.Response.Allowed)
+		require.NotNil(t, res.Response.Result)
+		assert.Equal(t, int32(http.StatusUnprocessableEntity), res.Response.Result.Code)
+		assert.Equal(t, metav1.StatusReasonInvalid, res.Response.Result.Reason)
+		require.NotNil(t, res.Response.Result.Details)
+
+		got := map[string]metav1.CauseType{}
+		for _, el := range res.Response.Result.Details.Causes {
+			got[el.Field] = el.Type
+		}
+		assert.Equal(t, map[string]metav1.CauseType{
+			"spec.widgetDataTemplate[1].forPath":    metav1.CauseTypeFieldValueInvalid,
+			"spec.widgetDataTemplate[1].expression": metav1.CauseTypeFieldValueInvalid,
+			"spec.resourcesRefs.items[1].id":        metav1.CauseTypeFieldValueDuplicate,
+		}, got)
+		assert.Contains(t, res.Response.Result.Message, `property "colour" not found in widgetData`)
+	})
+
+	t.Run("valid widget is allowed", func(t *testing.T) {
+		var obj admissionv1.AdmissionReview
+		require.NoError(t, json.Unmarshal(review, &obj))
+
+		var widget map[string]any
+		require.NoError(t, json.Unmarshal(obj.Request.Object.Raw, &widget))
+		spec := widget["spec"].(map[string]any)
+		spec["widgetDataTemplate"] = spec["widgetDataTemplate"].([]any)[:1]
+		spec["resourcesRefs"].(map[string]any)["items"] = spec["resourcesRefs"].(map[string]any)["items"].([]any)[:1]
+
+		obj.Request.Object.Raw, err = json.Marshal(widget)
+		require.NoError(t, err)
+		dat, err := json.Marshal(obj)
+		require.NoError(t, err)
+
+		res := serveAdmission(t, h, dat)
+		assert.True(t, res.Response.Allowed)
+		assert.Nil(t, res.Response.Result)
+	})
+
+	t.Run("missing CRD fails open", func(t *testing.T) {
+		h := &admissionHandler{getCRD: func(context.Context, string) (map[string]any, error) {
+			return nil, errors.New("not found")
+		}}
+
+		res := serveAdmission(t, h, review)
+		assert.True(t, res.Response.Allowed)
+		assert.Len(t, res.Response.Warnings, 1)
+	})
+
+	t.Run("malformed review", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/admission", bytes.NewReader([]byte(`{}`)))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	"github.com/krateoplatformops/smithery/internal/forge"
+	"github.com/krateoplatformops/smithery/internal/handlers/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// @Summary Refresh the allowed resources of the forged widgets
+// @Description Re-expands, from the current API discovery, the allowed resources of the widgets
+// @Description forged with an 'x-krateo-allowed-resources' selector, updating the CRDs that changed.
+// @ID refresh-allowed-resources
+// @Produce  json
+// @Param resource query []string false "Resource names (all the widgets with a selector when missing)" collectionFormat(multi)
+// @Success 200 {array} refreshItem
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 500 {object} errorStatus
+// @Router /allowedresources/refresh [post]
+// @Security Bearer
+func RefreshAllowedResources(pool *dynamic.Pool, store *crds.Cache) http.Handler {
+	return &refreshHandler{
+		lister: &listHandler{
+			pool:  pool,
+			store: store,
+		},
+	}
+}
+
+var _ http.Handler = (*refreshHandler)(nil)
+
+type refreshHandler struct {
+	lister *listHandler
+}
+
+// refreshItem is the outcome of the refresh of a widget CRD.
+type refreshItem struct {
+	Name             string                  `json:"name"`
+	Resource         string                  `json:"resource"`
+	Selector         *forge.ResourceSelector `json:"selector"`
+	AllowedResources []string                `json:"allowedResources"`
+	Updated          bool                    `json:"updated"`
+	Error            *errorStatus            `json:"error,omitempty"`
+}
+
+func (r *refreshHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	log := xcontext.Logger(req.Context())
+
+	start := time.Now()
+
+	ep, err := xcontext.UserConfig(req.Context())
+	if err != nil {
+		log.Error("unable to get user endpoint", slog.Any("err", err))
+		response.Unauthorized(wri, err)
+		return
+	}
+
+	cli, err := r.lister.pool.ClientFor(req.Context(), ep)
+	if err != nil {
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
+		response.InternalError(wri, err)
+		return
+	}
+
+	all, err := r.lister.listCRDs(wri, req, cli)
+	if err != nil {
+		return
+	}
+
+	only := req.URL.Query()["resource"]
+
+	// The shared discovery may predate the last installed resources:
+	// the reset is throttled, so refreshes cannot force full discoveries.
+	cli.ResetMapper()
+
+	// Widgets with the same selector share the same allowed resources.
+	resolved := map[forge.ResourceSelector][]string{}
+
+	res := []refreshItem{}
+	for _, crd := range all {
+		if crdGroup, _, _ := unstructured.NestedString(crd, "spec", "group"); crdGroup != WidgetsGroup {
+			continue
+		}
+
+		plural, _, _ := unstructured.NestedString(crd, "spec", "names", "plural")
+		if len(only) > 0 && !slices.Contains(only, plural) {
+			continue
+		}
+
+		item, ok := newRefreshItem(crd, plural)
+		if !ok {
+			continue
+		}
+		if item.Error != nil {
+			log.Warn("invalid allowed resources selector", slog.String("name", item.Name), slog.String("err", item.Error.Message))
+			res = append(res, item)
+			continue
+		}
+		sel := item.Selector
+
+		allowed, ok := resolved[*sel]
+		if !ok {
+			allowed, err = sel.Resolve(req.Context(), cli.DiscoverResources)
+			if err != nil {
+				log.Error("unable to resolve allowed resources", slog.Any("selector", sel), slog.Any("err", err))
+				item.Error = schemaErrorStatus(err)
+				res = append(res, item)
+				continue
+			}
+			resolved[*sel] = allowed
+		}
+		item.AllowedResources = allowed
+
+		item.Updated, err = r.refresh(req.Context(), cli, crd, allowed)
+		if err != nil {
+			log.Error("unable to refresh allowed resources", slog.String("name", item.Name), slog.Any("err", err))
+			item.Error = schemaErrorStatus(err)
+		}
+
+		res = append(res, item)
+	}
+
+	log.Info("allowed resources refreshed", slog.Int("count", len(res)), slog.String("duration", util.ETA(start)))
+
+	wri.Header().Set("Content-Type", "application/json")
+	wri.WriteHeader(http.StatusOK)
+	json.NewEncoder(wri).Encode(res)
+}
+
+// newRefreshItem returns the refresh item of a widget CRD, with the error of an
+// invalid selector annotation; false when the CRD has no selector.
+func newRefreshItem(crd map[string]any, plural string) (refreshItem, bool) {
+	item := refreshItem{
+		Name:     dynamic.GetName(crd),
+		Resource: plural,
+	}
+
+	sel, err := forge.SelectorOf(crd)
+	if err != nil {
+		item.Error = newErrorStatus(http.StatusUnprocessableEntity, err)
+		return item, true
+	}
+	if sel == nil {
+		return item, false
+	}
+
+	item.Selector = sel
+	return item, true
+}
+
+// refresh updates the CRD when its allowed resources changed.
+func (r *refreshHandler) refresh(ctx context.Context, cli *dynamic.UnstructuredClient, crd map[string]any, allowed []string) (bool, error) {
+	changed, err := forge.SetAllowedResources(crd, allowed)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	uns := &unstructured.Unstructured{Object: crd}
+	uns.SetAPIVersion("apiextensions.k8s.io/v1")
+	uns.SetKind("CustomResourceDefinition")
+
+	_, err = cli.Update(ctx, uns, dynamic.Options{
+		GVR: schema.GroupVersionResource{
+			Group:    "apiextensions.k8s.io",
+			Version:  "v1",
+			Resource: "customresourcedefinitions",
+		},
+	})
+	return err == nil, err
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/krateoplatformops/smithery/internal/forge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRefreshItem(t *testing.T) {
+	crd := func(annotations map[string]any) map[string]any {
+		return map[string]any{
+			"metadata": map[string]any{
+				"name":        "buttons.widgets.templates.krateo.io",
+				"annotations": annotations,
+			},
+		}
+	}
+
+	_, ok := newRefreshItem(crd(nil), "buttons")
+	assert.False(t, ok)
+
+	item, ok := newRefreshItem(crd(map[string]any{
+		forge.AnnotationAllowedResources: `{"category":"widgets"}`,
+	}), "buttons")
+	require.True(t, ok)
+	assert.Nil(t, item.Error)
+	assert.Equal(t, &forge.ResourceSelector{Category: "widgets"}, item.Selector)
+
+	item, ok = newRefreshItem(crd(map[string]any{
+		forge.AnnotationAllowedResources: `{"category":`,
+	}), "buttons")
+	require.True(t, ok)
+	require.NotNil(t, item.Error)
+	assert.Equal(t, http.StatusUnprocessableEntity, item.Error.Code)
+	assert.Equal(t, "buttons.widgets.templates.krateo.io", item.Name)
+	assert.Equal(t, "buttons", item.Resource)
+}
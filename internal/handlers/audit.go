@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/krateoplatformops/smithery/internal/audit"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+)
+
+func Audit(pool *dynamic.Pool, auditor *audit.Recorder) http.Handler {
+	return &auditHandler{
+		pool:    pool,
+		auditor: auditor,
+	}
+}
+
+var _ http.Handler = (*auditHandler)(nil)
+
+type auditHandler struct {
+	pool    *dynamic.Pool
+	auditor *audit.Recorder
+}
+
+// @Summary Audit Endpoint
+// @Description Returns the forge audit history of a Widget, oldest first
+// @ID audit
+// @Produce  json
+// @Param kind query string true "Widget kind (i.e. Button)"
+// @Param group query string false "Widget API group" default(widgets.templates.krateo.io)
+// @Success 200 {array} audit.Entry
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 500 {object} errorStatus
+// @Failure 503 {object} errorStatus
+// @Router /audit [get]
+// @Security Bearer
+func (r *auditHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	log := xcontext.Logger(req.Context())
+
+	if r.auditor == nil {
+		response.ServiceUnavailable(wri, fmt.Errorf("forge audit trail is disabled"))
+		return
+	}
+
+	kind := req.URL.Query().Get("kind")
+	if len(kind) == 0 {
+		response.BadRequest(wri, fmt.Errorf("missing 'kind' query parameter"))
+		return
+	}
+
+	group := req.URL.Query().Get("group")
+	if len(group) == 0 {
+		group = WidgetsGroup
+	}
+
+	ep, err := xcontext.UserConfig(req.Context())
+	if err != nil {
+		log.Error("unable to get user endpoint", slog.Any("err", err))
+		response.Unauthorized(wri, err)
+		return
+	}
+
+	cli, err := r.pool.ClientFor(req.Context(), ep)
+	if err != nil {
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
+		response.InternalError(wri, err)
+		return
+	}
+
+	if !authorize(wri, req, cli.RESTConfig(), crdAttributes("list", "")) {
+		return
+	}
+
+	all, err := r.auditor.List(req.Context(), group, kind)
+	if err != nil {
+		log.Error("unable to list forge audit entries",
+			slog.String("group", group), slog.String("kind", kind), slog.Any("err", err))
+		writeError(wri, err)
+		return
+	}
+
+	wri.Header().Set("Content-Type", "application/json")
+	wri.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(wri)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(all); err != nil {
+		log.Error("unable to serve api call response", slog.Any("err", err))
+	}
+}
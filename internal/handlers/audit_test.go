@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/krateoplatformops/smithery/internal/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditBadRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		auditor *audit.Recorder
+		query   string
+		code    int
+	}{
+		{
+			name:  "audit disabled",
+			query: "kind=Button",
+			code:  http.StatusServiceUnavailable,
+		},
+		{
+			name:    "missing kind",
+			auditor: &audit.Recorder{},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "missing user config",
+			auditor: &audit.Recorder{},
+			query:   "kind=Button",
+			code:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/audit?"+tc.query, nil)
+			rec := httptest.NewRecorder()
+
+			Audit(nil, tc.auditor).ServeHTTP(rec, req)
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
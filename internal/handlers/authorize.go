@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/smithery/internal/access"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// authorize checks, with the user credentials, that the specified action is allowed.
+// When it is not, it writes the error response and returns false.
+func authorize(wri http.ResponseWriter, req *http.Request, rc *rest.Config, attrs authorizationv1.ResourceAttributes) bool {
+	err := checkAccess(req.Context(), rc, attrs)
+	if err == nil {
+		return true
+	}
+
+	log := xcontext.Logger(req.Context())
+	if apierrors.IsForbidden(err) {
+		log.Warn("access denied", slog.String("reason", err.Error()))
+	} else {
+		log.Error("unable to review user access", slog.Any("err", err))
+	}
+	writeError(wri, err)
+
+	return false
+}
+
+// checkAccess checks, with the user credentials, that the specified action is allowed.
+// When it is not, it returns a Forbidden *StatusError naming the missing permission.
+func checkAccess(ctx context.Context, rc *rest.Config, attrs authorizationv1.ResourceAttributes) error {
+	res, err := access.Review(ctx, rc, attrs)
+	if err != nil {
+		return err
+	}
+
+	if res.Allowed {
+		return nil
+	}
+
+	msg := fmt.Sprintf("user cannot %s", access.Describe(attrs))
+	if len(res.Reason) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, res.Reason)
+	}
+
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: msg,
+		Details: &metav1.StatusDetails{
+			Group: attrs.Group,
+			Kind:  attrs.Resource,
+			Name:  attrs.Name,
+		},
+	}}
+}
+
+func crdAttributes(verb, name string) authorizationv1.ResourceAttributes {
+	return authorizationv1.ResourceAttributes{
+		Verb:     verb,
+		Group:    "apiextensions.k8s.io",
+		Version:  "v1",
+		Resource: "customresourcedefinitions",
+		Name:     name,
+	}
+}
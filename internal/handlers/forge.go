@@ -3,22 +3,35 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"mime"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/krateoplatformops/crdgen/v2"
-	"github.com/krateoplatformops/krateoctl/jsonschema"
 	xcontext "github.com/krateoplatformops/plumbing/context"
 	"github.com/krateoplatformops/plumbing/http/response"
-	"github.com/krateoplatformops/plumbing/kubeconfig"
+	"github.com/krateoplatformops/smithery/internal/audit"
+	"github.com/krateoplatformops/smithery/internal/controller"
+	"github.com/krateoplatformops/smithery/internal/crds"
 	"github.com/krateoplatformops/smithery/internal/dynamic"
+	"github.com/krateoplatformops/smithery/internal/forge"
 	"github.com/krateoplatformops/smithery/internal/handlers/util"
+	"github.com/krateoplatformops/smithery/internal/limits"
+	"github.com/krateoplatformops/smithery/internal/metrics"
+	"github.com/krateoplatformops/smithery/internal/revisions"
+	"github.com/krateoplatformops/smithery/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	runtimeschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // @Summary Generate a CRD from a JSON Schema
@@ -27,25 +40,80 @@ import (
 // @Param apiVersion query string true "API Version"
 // @Param resource query string true "Resource name"
 // @Param apply query bool true "Apply Generated CRD"
+// @Param wait query bool false "Wait for the applied CRD to be established and return its conditions"
+// @Param timeout query string false "How long to wait for the CRD to be established (default 30s)"
 // @Produce      plain
+// @Produce      json
 // @Success      200  {string}  string  "CRD YAML"
+// @Success      200  {object}  forgeResult  "CRD conditions (when wait=true)"
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus "missing permission on the CRD"
+// @Failure 409 {object} errorStatus "CRD managed by a WidgetDefinition"
+// @Failure 413 {object} errorStatus
+// @Failure 422 {object} errorStatus
+// @Failure 429 {object} errorStatus
+// @Failure 504 {object} errorStatus
 // @Router /forge [get]
 // @Security Bearer
-func Forge() http.Handler {
-	return &forgeHandler{}
+func Forge(pool *dynamic.Pool, auditor *audit.Recorder, history *revisions.Store, schemaLimits forge.Limits) http.Handler {
+	return &forgeHandler{
+		pool:    pool,
+		auditor: auditor,
+		history: history,
+		limits:  schemaLimits,
+	}
 }
 
 const (
-	//maxBodySize           = 100 * 1024
-	widgetsGroup          = "widgets.templates.krateo.io"
-	preserveUnknownFields = `{"type": "object", "additionalProperties": true,"x-kubernetes-preserve-unknown-fields": true}`
+	WidgetsGroup        = forge.DefaultGroup
+	establishTimeout    = 30 * time.Second
+	maxEstablishTimeout = 5 * time.Minute
+	auditTimeout        = 5 * time.Second
 )
 
 var _ http.Handler = (*forgeHandler)(nil)
 
-type forgeHandler struct{}
+var crdGVR = runtimeschema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// crdName returns the name of the CRD forged for a widget kind.
+func crdName(kind string) string {
+	return forge.CRDName(WidgetsGroup, kind)
+}
+
+type forgeHandler struct {
+	pool    *dynamic.Pool
+	auditor *audit.Recorder
+	history *revisions.Store
+	limits  forge.Limits
+}
 
 func (r *forgeHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	outcome := metrics.OutcomeInvalidRequest
+
+	// Set when the CRD is going to be applied.
+	var (
+		entry   *audit.Entry
+		applied *unstructured.Unstructured
+		failure error
+	)
+
+	defer func() {
+		metrics.ForgeOutcome(outcome)
+
+		if entry != nil {
+			entry.Outcome = auditOutcome(outcome)
+			if failure != nil {
+				entry.Message = failure.Error()
+			}
+			r.record(req.Context(), entry, applied)
+		}
+	}()
+
 	if req.Method != http.MethodPost {
 		response.MethodNotAllowed(wri,
 			fmt.Errorf("method %q is not allowed, only POST is supported", req.Method))
@@ -63,59 +131,96 @@ func (r *forgeHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 		apply = true
 	}
 
-	src := map[string]any{}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&src); err != nil {
-		if err == io.EOF {
-			response.BadRequest(wri, fmt.Errorf("empty body"))
-		} else {
-			response.BadRequest(wri, err)
-		}
+	waitOpts, err := parseWaitOptions(req)
+	if err != nil {
+		response.BadRequest(wri, err)
 		return
 	}
 
-	kind, version, err := jsonschema.ExtractKindAndVersion(src)
+	body, err := io.ReadAll(req.Body)
 	if err != nil {
-		response.BadRequest(wri, fmt.Errorf("unable to extract kind and version from JSON Schema: %w", err))
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			limits.TooLarge(wri, err)
+		} else {
+			response.BadRequest(wri, err)
+		}
 		return
 	}
-
-	allowedResources, err := jsonschema.ExtractAllowedResources(src)
-	if err != nil {
-		response.BadRequest(wri, fmt.Errorf("unable to extract allowedResources from JSON Schema: %w", err))
+	if len(body) == 0 {
+		response.BadRequest(wri, fmt.Errorf("empty body"))
 		return
 	}
 
-	spec, err := jsonschema.ExtractSpec(src)
+	metrics.ObserveForgeSchemaSize(len(body))
+
+	ctx := req.Context()
+
+	_, span := tracing.Start(ctx, "forge.parse")
+	widget, err := r.parse(body)
+	tracing.End(span, err)
 	if err != nil {
-		response.BadRequest(wri, fmt.Errorf("unable to extract spec from JSON Schema: %w", err))
+		var le *forge.LimitError
+		if errors.As(err, &le) {
+			limits.TooLarge(wri, err)
+		} else {
+			response.BadRequest(wri, err)
+		}
 		return
 	}
+	kind, version := widget.Kind, widget.Version
 
-	if len(allowedResources) > 0 {
-		err = jsonschema.SetAllowedResources(spec, allowedResources)
+	if apply {
+		// Generating the CRD is expensive: fail fast when it cannot be applied.
+		_, span = tracing.Start(ctx, "forge.authorize")
+		err = r.checkApplyAccess(ctx, kind, !waitOpts.skip)
+		tracing.End(span, err)
 		if err != nil {
-			response.InternalError(wri, fmt.Errorf("unable to inject allowed resources into JSON Schema: %W", err))
+			outcome = metrics.OutcomeApplyError
+			switch {
+			case apierrors.IsForbidden(err):
+				outcome = metrics.OutcomeForbidden
+				xcontext.Logger(ctx).Warn("access denied", slog.String("reason", err.Error()))
+			case apierrors.IsConflict(err):
+				xcontext.Logger(ctx).Warn("CRD managed by a WidgetDefinition", slog.String("reason", err.Error()))
+			default:
+				xcontext.Logger(ctx).Error("unable to review user access", slog.Any("err", err))
+			}
+			writeError(wri, err)
 			return
 		}
 	}
 
-	dat, err := json.Marshal(spec)
-	if err != nil {
-		response.InternalError(wri, fmt.Errorf("unable to convert extracted spec to JSON: %w", err))
-		return
+	if widget.Selector != nil {
+		_, span = tracing.Start(ctx, "forge.discover")
+		err = r.expandAllowedResources(ctx, &widget)
+		tracing.End(span, err)
+		if err != nil {
+			xcontext.Logger(ctx).Error("unable to expand allowed resources", slog.Any("err", err))
+			writeError(wri, err)
+			return
+		}
 	}
 
-	opts := crdgen.Options{
-		Group:        widgetsGroup,
-		Version:      version,
-		Kind:         kind,
-		Categories:   []string{"widgets", "krateo"},
-		SpecSchema:   []byte(dat),
-		StatusSchema: []byte(preserveUnknownFields),
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("widget.kind", kind),
+		attribute.String("widget.version", version),
+	)
+
+	outcome = metrics.OutcomeGenerateError
+
+	if apply {
+		entry = &audit.Entry{
+			User:       forgeUser(ctx),
+			Group:      WidgetsGroup,
+			Kind:       kind,
+			Version:    version,
+			SchemaHash: audit.SchemaHash(body),
+			TraceId:    xcontext.TraceId(ctx, false),
+		}
 	}
 
-	log := xcontext.Logger(req.Context()).
+	log := xcontext.Logger(ctx).
 		With(
 			slog.Group("widget",
 				slog.String("kind", kind),
@@ -126,62 +231,352 @@ func (r *forgeHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 	log.Info("generating CRD")
 
 	start := time.Now()
-	res, err := crdgen.Generate(opts)
+	_, span = tracing.Start(ctx, "forge.generate")
+	res, err := forge.Generate(WidgetsGroup, widget)
+	tracing.End(span, err)
 	if err != nil {
+		failure = err
 		log.Error("unable to generate CRD", slog.Any("err", err))
 		response.InternalError(wri, fmt.Errorf("unable to generate CRD: %w", err))
 		return
 	}
 
 	log.Info("CRD successfully generated", slog.String("duration", util.ETA(start)))
+	metrics.ObserveForgeStage(metrics.StageGenerate, start)
 
 	if apply {
 		log.Info("applying CRD")
 		start = time.Now()
 
-		err := r.applyCRD(req.Context(), res)
+		actx, span := tracing.Start(ctx, "forge.apply")
+		// The revision is stored first, so that the CRD never references a missing one.
+		rev, err := r.saveRevision(actx, entry, body)
 		if err != nil {
-			response.Unauthorized(wri, err)
+			// The schema history is not vital: the CRD is applied anyway, without references.
+			log.Error("unable to store schema revision", slog.Any("err", err))
+		}
+
+		cli, obj, err := r.applyCRD(actx, res, rev)
+		tracing.End(span, err)
+		if err != nil {
+			outcome, failure = metrics.OutcomeApplyError, err
+			log.Error("unable to apply CRD", slog.Any("err", err))
+			if rev != nil {
+				if err := r.history.Delete(context.WithoutCancel(ctx), *rev); err != nil {
+					log.Error("unable to delete schema revision", slog.Any("err", err))
+				}
+			}
+			writeError(wri, err)
 			return
 		}
 
 		log.Info("CRD successfully applied", slog.String("duration", util.ETA(start)))
+		metrics.ObserveForgeStage(metrics.StageApply, start)
+
+		name := obj.GetName()
+		applied, entry.CRD = obj, name
+
+		if waitOpts.skip {
+			cli.ResetMapper()
+		} else {
+			if waitOpts.timeout > establishTimeout {
+				// Give the watch more time than the server WriteTimeout.
+				http.NewResponseController(wri).
+					SetWriteDeadline(time.Now().Add(waitOpts.timeout + 10*time.Second))
+			}
+
+			start = time.Now()
+			wctx, span := tracing.Start(ctx, "forge.establish")
+			conds, err := crds.WaitForEstablished(wctx, cli, name, waitOpts.timeout)
+			tracing.End(span, err)
+			if err != nil {
+				failure = err
+				log.Error("CRD not established", slog.Any("err", err))
+
+				var nna *crds.NamesNotAcceptedError
+				switch {
+				case errors.As(err, &nna):
+					outcome = metrics.OutcomeNamesNotAccepted
+					response.Encode(wri, response.New(http.StatusUnprocessableEntity, err))
+				case wait.Interrupted(err):
+					outcome = metrics.OutcomeTimeout
+					gatewayTimeout(wri, err)
+				default:
+					outcome = metrics.OutcomeNotEstablished
+					writeError(wri, err)
+				}
+				return
+			}
+
+			// The pooled client may have cached the API discovery
+			// before the new kind was served: drop it.
+			cli.ResetMapper()
+
+			log.Info("CRD established", slog.String("duration", util.ETA(start)))
+			metrics.ObserveForgeStage(metrics.StageEstablish, start)
+
+			if waitOpts.conditions {
+				outcome = metrics.OutcomeSuccess
+				wri.Header().Set("Content-Type", "application/json")
+				wri.WriteHeader(http.StatusOK)
+				json.NewEncoder(wri).Encode(&forgeResult{
+					Name:       name,
+					Kind:       kind,
+					Version:    version,
+					Conditions: conds,
+				})
+				return
+			}
+		}
 	}
 
+	outcome = metrics.OutcomeSuccess
+
 	wri.Header().Set("Content-Type", "application/yaml")
 	wri.WriteHeader(http.StatusOK)
 	wri.Write(res)
 }
 
-func (r *forgeHandler) applyCRD(ctx context.Context, crd []byte) error {
+// parse decodes the widget JSON Schema, within the limits.
+func (r *forgeHandler) parse(body []byte) (forge.Widget, error) {
+	src := map[string]any{}
+	if err := json.Unmarshal(body, &src); err != nil {
+		return forge.Widget{}, err
+	}
+
+	if err := r.limits.Check(src); err != nil {
+		return forge.Widget{}, err
+	}
+
+	return forge.Parse(src)
+}
+
+// client returns the Kubernetes client with the user credentials.
+func (r *forgeHandler) client(ctx context.Context) (*dynamic.UnstructuredClient, error) {
 	ep, err := xcontext.UserConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to get user endpoint: %w", err)
+		return nil, apierrors.NewUnauthorized(fmt.Sprintf("unable to get user endpoint: %s", err))
 	}
 
-	rc, err := kubeconfig.NewClientConfig(ctx, ep)
+	cli, err := r.pool.ClientFor(ctx, ep)
 	if err != nil {
-		return fmt.Errorf("unable to create kubernetes client config: %w", err)
+		return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
 	}
 
-	dc, err := dynamic.NewClient(rc)
+	return cli, nil
+}
+
+// checkApplyAccess checks, with SelfSubjectAccessReviews, that the user can
+// apply the CRD of the widget kind: get it and update it when it already
+// exists, create it otherwise, and watch it when waiting for Established.
+// The CRDs controlled by a WidgetDefinition are refused with a Conflict: the
+// apply would overwrite the labels and owner references of the controller.
+func (r *forgeHandler) checkApplyAccess(ctx context.Context, kind string, wait bool) error {
+	cli, err := r.client(ctx)
 	if err != nil {
 		return err
 	}
 
-	uns, err := dc.YAMLBytesToUnstructured(crd)
+	name := crdName(kind)
+	rc := cli.RESTConfig()
+
+	if err := checkAccess(ctx, rc, crdAttributes("get", name)); err != nil {
+		return err
+	}
+
+	exists := true
+	existing, err := cli.Get(ctx, name, dynamic.Options{GVR: crdGVR})
 	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists = false
+	} else if err := checkNotDefined(existing); err != nil {
 		return err
 	}
+
+	for _, verb := range applyVerbs(exists, wait) {
+		if err := checkAccess(ctx, rc, crdAttributes(verb, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkNotDefined returns a Conflict when the CRD is controlled by a
+// WidgetDefinition, which must be changed instead.
+func checkNotDefined(crd *unstructured.Unstructured) error {
+	wd, ok := controller.DefinitionOf(crd)
+	if !ok {
+		return nil
+	}
+
+	return apierrors.NewConflict(crdGVR.GroupResource(), crd.GetName(),
+		fmt.Errorf("the CRD is managed by the WidgetDefinition %q, update it instead", wd))
+}
+
+// applyVerbs returns the verbs, besides get, needed on a CRD to apply it
+// and, with wait, to watch it until Established.
+func applyVerbs(exists, wait bool) []string {
+	verbs := []string{"create"}
+	if exists {
+		verbs = []string{"update"}
+	}
+	if wait {
+		verbs = append(verbs, "watch")
+	}
+	return verbs
+}
+
+// expandAllowedResources derives the allowed resources of the widget from the
+// API discovery, with the user credentials.
+func (r *forgeHandler) expandAllowedResources(ctx context.Context, w *forge.Widget) error {
+	cli, err := r.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The shared discovery may predate the last installed resources:
+	// the reset is throttled, so forges cannot force full discoveries.
+	cli.ResetMapper()
+
+	return w.ExpandAllowedResources(ctx, cli.DiscoverResources)
+}
+
+// saveRevision stores the input schema of the CRD going to be applied and returns
+// its revision, nil when the schema history is disabled.
+func (r *forgeHandler) saveRevision(ctx context.Context, entry *audit.Entry, body []byte) (*revisions.Revision, error) {
+	if r.history == nil {
+		return nil, nil
+	}
+
+	rev, err := r.history.Save(ctx, revisions.Revision{
+		Group:      entry.Group,
+		Kind:       entry.Kind,
+		Version:    entry.Version,
+		SchemaHash: entry.SchemaHash,
+		User:       entry.User,
+	}, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+func (r *forgeHandler) applyCRD(ctx context.Context, crd []byte, rev *revisions.Revision) (*dynamic.UnstructuredClient, *unstructured.Unstructured, error) {
+	dc, err := r.client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uns, err := dc.YAMLBytesToUnstructured(crd)
+	if err != nil {
+		return nil, nil, err
+	}
 	uns.SetAPIVersion("apiextensions.k8s.io/v1")
 	uns.SetKind("CustomResourceDefinition")
+	if rev != nil {
+		ann := uns.GetAnnotations()
+		if ann == nil {
+			ann = map[string]string{}
+		}
+		maps.Copy(ann, rev.Annotations())
+		uns.SetAnnotations(ann)
+	}
+
+	res, err := dc.Apply(ctx, uns, dynamic.Options{GVR: crdGVR})
+	return dc, res, err
+}
+
+// auditOutcome maps the forge outcome of an applied CRD to the audit one.
+func auditOutcome(outcome string) audit.Outcome {
+	switch outcome {
+	case metrics.OutcomeSuccess:
+		return audit.OutcomeSuccess
+	case metrics.OutcomeGenerateError:
+		return audit.OutcomeGenerateError
+	case metrics.OutcomeNamesNotAccepted:
+		return audit.OutcomeNamesNotAccepted
+	case metrics.OutcomeTimeout:
+		return audit.OutcomeTimeout
+	case metrics.OutcomeNotEstablished:
+		return audit.OutcomeNotEstablished
+	default:
+		return audit.OutcomeApplyError
+	}
+}
+
+// record stores the audit entry of a forge, failures are only logged.
+func (r *forgeHandler) record(ctx context.Context, entry *audit.Entry, crd *unstructured.Unstructured) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	var obj runtime.Object
+	if crd != nil {
+		obj = crd
+	}
+
+	if err := r.auditor.Record(ctx, *entry, obj); err != nil {
+		xcontext.Logger(ctx).Error("unable to record forge audit entry", slog.Any("err", err))
+	}
+}
+
+type forgeResult struct {
+	Name       string           `json:"name"`
+	Kind       string           `json:"kind"`
+	Version    string           `json:"version"`
+	Conditions []crds.Condition `json:"conditions"`
+}
+
+type waitOptions struct {
+	// skip the wait for the Established condition (wait=false)
+	skip bool
+	// reply with the conditions instead of the CRD YAML (wait=true)
+	conditions bool
+	timeout    time.Duration
+}
 
-	_, err = dc.Apply(ctx, uns, dynamic.Options{
-		GVR: runtimeschema.GroupVersionResource{
-			Group:    "apiextensions.k8s.io",
-			Version:  "v1",
-			Resource: "customresourcedefinitions",
-		},
-	})
-	return err
+func parseWaitOptions(req *http.Request) (opts waitOptions, err error) {
+	opts.timeout = establishTimeout
+
+	if val := req.URL.Query().Get("wait"); len(val) > 0 {
+		ok, err := strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid 'wait' query parameter: %w", err)
+		}
+		opts.skip = !ok
+		opts.conditions = ok
+	}
+
+	if val := req.URL.Query().Get("timeout"); len(val) > 0 {
+		opts.timeout, err = time.ParseDuration(val)
+		if err != nil {
+			return opts, fmt.Errorf("invalid 'timeout' query parameter: %w", err)
+		}
+		if opts.timeout <= 0 || opts.timeout > maxEstablishTimeout {
+			return opts, fmt.Errorf("'timeout' query parameter must be between 0 and %s", maxEstablishTimeout)
+		}
+	}
+
+	return opts, nil
+}
+
+func gatewayTimeout(wri http.ResponseWriter, err error) error {
+	status := response.New(http.StatusGatewayTimeout, err)
+	status.Status = response.StatusFailure
+	status.Reason = response.StatusReasonTimeout
+	return response.Encode(wri, status)
+}
+
+// forgeUser returns the name of the user forging, as recorded in the audit trail.
+func forgeUser(ctx context.Context) string {
+	if ep, err := xcontext.UserConfig(ctx); err == nil && len(ep.Username) > 0 {
+		return ep.Username
+	}
+	if ui, err := xcontext.UserInfo(ctx); err == nil {
+		return ui.Username
+	}
+	return ""
 }
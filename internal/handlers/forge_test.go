@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/smithery/internal/audit"
+	"github.com/krateoplatformops/smithery/internal/controller"
+	"github.com/krateoplatformops/smithery/internal/forge"
+	"github.com/krateoplatformops/smithery/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseWaitOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    waitOptions
+		wantErr bool
+	}{
+		{
+			query: "apply=true",
+			want:  waitOptions{timeout: establishTimeout},
+		},
+		{
+			query: "wait=true&timeout=45s",
+			want:  waitOptions{conditions: true, timeout: 45 * time.Second},
+		},
+		{
+			query: "wait=false",
+			want:  waitOptions{skip: true, timeout: establishTimeout},
+		},
+		{
+			query:   "wait=maybe",
+			wantErr: true,
+		},
+		{
+			query:   "wait=true&timeout=soon",
+			wantErr: true,
+		},
+		{
+			query:   "wait=true&timeout=1h",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/forge?"+tc.query, nil)
+
+			got, err := parseWaitOptions(req)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestForgeParseLimits(t *testing.T) {
+	body, err := os.ReadFile("../../testdata/widgets.templates.krateo.io_buttons.json")
+	require.NoError(t, err)
+
+	r := &forgeHandler{}
+	_, err = r.parse(body)
+	assert.NoError(t, err)
+
+	r.limits = forge.Limits{MaxDepth: 3}
+	_, err = r.parse(body)
+	var le *forge.LimitError
+	assert.ErrorAs(t, err, &le)
+}
+
+func TestApplyVerbs(t *testing.T) {
+	assert.Equal(t, []string{"create"}, applyVerbs(false, false))
+	assert.Equal(t, []string{"update"}, applyVerbs(true, false))
+	assert.Equal(t, []string{"create", "watch"}, applyVerbs(false, true))
+	assert.Equal(t, []string{"update", "watch"}, applyVerbs(true, true))
+}
+
+func TestCheckNotDefined(t *testing.T) {
+	crd := &unstructured.Unstructured{}
+	crd.SetName(crdName("Button"))
+	assert.NoError(t, checkNotDefined(crd))
+
+	crd.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: controller.GVR.GroupVersion().String(),
+		Kind:       controller.Kind,
+		Name:       "button",
+		UID:        "wd-uid",
+		Controller: ptr.To(true),
+	}})
+	err := checkNotDefined(crd)
+	assert.True(t, apierrors.IsConflict(err))
+	assert.Contains(t, err.Error(), `WidgetDefinition "button"`)
+
+	// Only the WidgetDefinition controllers are refused.
+	crd.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       "button",
+		UID:        "cm-uid",
+		Controller: ptr.To(true),
+	}})
+	assert.NoError(t, checkNotDefined(crd))
+}
+
+func TestAuditOutcome(t *testing.T) {
+	assert.Equal(t, audit.OutcomeSuccess, auditOutcome(metrics.OutcomeSuccess))
+	assert.Equal(t, audit.OutcomeTimeout, auditOutcome(metrics.OutcomeTimeout))
+	assert.Equal(t, audit.OutcomeApplyError, auditOutcome(metrics.OutcomeApplyError))
+}
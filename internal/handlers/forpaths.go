@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	"github.com/krateoplatformops/smithery/internal/handlers/util"
+	"github.com/krateoplatformops/smithery/internal/widgets"
+)
+
+// @Summary List or check the widgetDataTemplate forPaths
+// @Description Without 'forPath' returns every widgetData property a widgetDataTemplate can target, with its type.
+// @Description With 'forPath' checks it and, when 'expression' is specified too, that a literal value matches the target type.
+// @ID forpaths
+// @Produce  json
+// @Param version query string false "API Version"
+// @Param apiVersion query string false "API Version with group (i.e. widgets.templates.krateo.io/v1beta1), alternative to version"
+// @Param resource query string false "Resource name"
+// @Param kind query string false "Kind (i.e. Button), alternative to resource"
+// @Param forPath query string false "forPath to check (i.e. actions.navigate[0].path)"
+// @Param expression query string false "widgetDataTemplate expression whose literal value type is checked against the forPath one"
+// @Param If-None-Match header string false "ETag of the cached copy"
+// @Success 200 {array} widgets.ForPath
+// @Success 200 {object} forPathCheck "with forPath"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 404 {object} errorStatus
+// @Failure 500 {object} errorStatus
+// @Router /forpaths [get]
+// @Security Bearer
+func ForPaths(pool *dynamic.Pool, store *crds.Cache) http.Handler {
+	return &forPathsHandler{
+		schemas: &schemaHandler{
+			pool:  pool,
+			store: store,
+		},
+	}
+}
+
+var _ http.Handler = (*forPathsHandler)(nil)
+
+type forPathsHandler struct {
+	schemas *schemaHandler
+}
+
+// forPathCheck is the outcome of a forPath check.
+type forPathCheck struct {
+	ForPath string           `json:"forPath"`
+	Valid   bool             `json:"valid"`
+	Target  *widgets.ForPath `json:"target,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+func (r *forPathsHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	refs, _, err := parseSchemaRefs(req)
+	if err != nil {
+		response.BadRequest(wri, err)
+		return
+	}
+	if len(refs) > 1 {
+		response.BadRequest(wri, fmt.Errorf("only one 'resource' or 'kind' query parameter is allowed"))
+		return
+	}
+
+	ref := refs[0]
+	if len(ref.Version) == 0 {
+		response.BadRequest(wri, fmt.Errorf("missing 'version' or 'apiVersion' query parameter"))
+		return
+	}
+
+	log := xcontext.Logger(req.Context()).With(
+		slog.Group("resource",
+			slog.String("name", ref.Resource),
+			slog.String("kind", ref.Kind),
+			slog.String("group", ref.Group),
+			slog.String("version", ref.Version),
+		),
+	)
+
+	start := time.Now()
+
+	ep, err := xcontext.UserConfig(req.Context())
+	if err != nil {
+		log.Error("unable to get user endpoint", slog.Any("err", err))
+		response.Unauthorized(wri, err)
+		return
+	}
+
+	cli, err := r.schemas.pool.ClientFor(req.Context(), ep)
+	if err != nil {
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
+		response.InternalError(wri, err)
+		return
+	}
+
+	sub, err := r.schemas.resolve(req.Context(), cli, ref, schemaSelector{path: "spec.widgetData"})
+	if err != nil {
+		log.Error("unable to fetch widgetData schema", slog.Any("err", err))
+		writeStatus(wri, schemaErrorStatus(err))
+		return
+	}
+
+	wd, ok := sub.(map[string]any)
+	if !ok {
+		response.InternalError(wri, fmt.Errorf("invalid widgetData schema"))
+		return
+	}
+
+	var res any = widgets.ForPaths(wd)
+	if forPath := req.URL.Query().Get("forPath"); len(strings.TrimSpace(forPath)) > 0 {
+		res = checkForPath(wd, forPath, req.URL.Query()["expression"])
+	}
+
+	dat, err := json.Marshal(res)
+	if err != nil {
+		response.InternalError(wri, err)
+		return
+	}
+
+	log.Info("forPaths successfully resolved", slog.String("duration", util.ETA(start)))
+
+	if err := util.WriteCacheable(wri, req, "application/json", append(dat, '\n')); err != nil {
+		log.Error("unable to serve forPaths", slog.Any("err", err))
+	}
+}
+
+// checkForPath looks up forPath and checks the type of the expression, if any.
+func checkForPath(wd map[string]any, forPath string, expression []string) forPathCheck {
+	res := forPathCheck{ForPath: forPath}
+
+	target, err := widgets.LookupForPath(wd, forPath)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Target = &target
+
+	if len(expression) > 0 {
+		if err := target.CheckType(widgets.TypeOf(expression[0])); err != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+
+	res.Valid = true
+	return res
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/smithery/internal/widgets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckForPath(t *testing.T) {
+	wd := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"label": map[string]any{"type": "string"},
+			"size":  map[string]any{"type": "string", "enum": []any{"small", "large"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		forPath    string
+		expression []string
+		want       forPathCheck
+	}{
+		{
+			name:    "existing forPath",
+			forPath: "size",
+			want: forPathCheck{ForPath: "size", Valid: true,
+				Target: &widgets.ForPath{Path: "size", Type: "string", Enum: []any{"small", "large"}}},
+		},
+		{
+			name:    "unknown forPath",
+			forPath: "colour",
+			want:    forPathCheck{ForPath: "colour", Error: `property "colour" not found in widgetData`},
+		},
+		{
+			name:       "matching expression",
+			forPath:    "label",
+			expression: []string{"${ .name }"},
+			want:       forPathCheck{ForPath: "label", Valid: true, Target: &widgets.ForPath{Path: "label", Type: "string"}},
+		},
+		{
+			name:       "type mismatch",
+			forPath:    "label",
+			expression: []string{"42"},
+			want: forPathCheck{ForPath: "label", Target: &widgets.ForPath{Path: "label", Type: "string"},
+				Error: `integer value does not match the string type of "label"`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, checkForPath(wd, tc.forPath, tc.expression))
+		})
+	}
+}
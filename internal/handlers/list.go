@@ -8,32 +8,40 @@ import (
 
 	xcontext "github.com/krateoplatformops/plumbing/context"
 	"github.com/krateoplatformops/plumbing/http/response"
-	"github.com/krateoplatformops/plumbing/kubeconfig"
 	"github.com/krateoplatformops/plumbing/maps"
+	"github.com/krateoplatformops/smithery/internal/crds"
 	"github.com/krateoplatformops/smithery/internal/dynamic"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"github.com/krateoplatformops/smithery/internal/handlers/util"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-func List() http.Handler {
-	return &listHandler{}
+func List(pool *dynamic.Pool, store *crds.Cache) http.Handler {
+	return &listHandler{
+		pool:  pool,
+		store: store,
+	}
 }
 
 var _ http.Handler = (*listHandler)(nil)
 
 type listHandler struct {
+	pool  *dynamic.Pool
+	store *crds.Cache
 }
 
 // @Summary List Endpoint
 // @Description Returns information about Widgets API names
 // @ID list
 // @Produce  json
-// @Success 200 {object} info
-// @Failure 400 {object} response.Status
-// @Failure 401 {object} response.Status
-// @Failure 404 {object} response.Status
-// @Failure 500 {object} response.Status
+// @Param If-None-Match header string false "ETag of the cached copy"
+// @Success 200 {array} info
+// @Success 304 "Not Modified"
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 404 {object} errorStatus
+// @Failure 500 {object} errorStatus
 // @Router /list [get]
 // @Security Bearer
 func (r *listHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
@@ -46,87 +54,31 @@ func (r *listHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	rc, err := kubeconfig.NewClientConfig(req.Context(), ep)
+	cli, err := r.pool.ClientFor(req.Context(), ep)
 	if err != nil {
-		log.Error("unable to create kubernetes client config", slog.Any("err", err))
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
 		response.InternalError(wri, err)
 		return
 	}
 
-	cli, err := dynamic.NewClient(rc)
-	if err != nil {
-		log.Error("unable to create dynamic client", slog.Any("err", err))
-		response.InternalError(wri, err)
-		return
-	}
-
-	all, err := cli.List(req.Context(), dynamic.Options{
-		GVR: schema.GroupVersionResource{
-			Group:    "apiextensions.k8s.io",
-			Version:  "v1",
-			Resource: "customresourcedefinitions",
-		},
-	})
+	all, err := r.listCRDs(wri, req, cli)
 	if err != nil {
-		log.Error("unable to list customresourcedefinitions", slog.Any("err", err))
-		if apierrors.IsNotFound(err) {
-			response.NotFound(wri, err)
-		} else {
-			response.InternalError(wri, err)
-		}
 		return
 	}
-	if len(all.Items) == 0 {
-		log.Info("no customresourcedefinitions found")
-		response.NotFound(wri, err)
-	}
 
-	result := make([]info, 0, len(all.Items))
-	for _, el := range all.Items {
-		names, ok, err := maps.NestedMapNoCopy(el.Object, "spec", "names")
-		if err != nil {
-			log.Warn("unable to fetch spec.names in CRD", slog.Any("err", err))
-			continue
-		}
-		if !ok {
-			log.Warn("spec.names not found in CRD")
+	result := make([]info, 0, len(all))
+	for _, el := range all {
+		if group, _, _ := unstructured.NestedString(el, "spec", "group"); group != WidgetsGroup {
 			continue
 		}
 
-		group := ""
-		if val, ok := maps.NestedValue(el.Object, []string{"spec", "group"}); ok {
-			group = val.(string)
-		}
-
-		vers, _, err := unstructured.NestedSlice(el.Object, "spec", "versions")
+		nfo, err := widgetInfo(el)
 		if err != nil {
-			log.Error("unable to fetch spec.versions in CRD")
+			log.Warn("unable to extract widget info from CRD",
+				slog.String("name", dynamic.GetName(el)), slog.Any("err", err))
 			continue
 		}
-		versions := make([]string, 0, len(vers))
-		for _, vv := range vers {
-			ver, _, err := unstructured.NestedString(vv.(map[string]any), "name")
-			if err == nil {
-				versions = append(versions, ver)
-			}
-		}
-
-		plural, ok := names["plural"].(string)
-		if !ok {
-			log.Warn("spec.names.plural not found in CRD")
-			continue
-		}
-		kind, ok := names["kind"].(string)
-		if !ok {
-			log.Warn("spec.names.kind not found in CRD")
-			continue
-		}
-		result = append(result, info{
-			Resource: plural,
-			Kind:     kind,
-			Group:    group,
-			Versions: versions,
-		})
+		result = append(result, nfo)
 	}
 
 	if len(result) == 0 {
@@ -136,12 +88,13 @@ func (r *listHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	wri.Header().Set("Content-Type", "application/json")
-	wri.WriteHeader(http.StatusOK)
+	dat, err := json.MarshalIndent(&result, "", "  ")
+	if err != nil {
+		response.InternalError(wri, err)
+		return
+	}
 
-	enc := json.NewEncoder(wri)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(&result); err != nil {
+	if err := util.WriteCacheable(wri, req, "application/json", append(dat, '\n')); err != nil {
 		log.Error("unable to serve api call response", slog.Any("err", err))
 	}
 }
@@ -152,3 +105,80 @@ type info struct {
 	Versions []string `json:"versions"`
 	Group    string   `json:"group"`
 }
+
+// listCRDs returns the CRDs from the cache, when available, or from the API server.
+// On failure the error response has already been written.
+func (r *listHandler) listCRDs(wri http.ResponseWriter, req *http.Request, cli *dynamic.UnstructuredClient) ([]map[string]any, error) {
+	if r.store.Ready() {
+		if !authorize(wri, req, cli.RESTConfig(), crdAttributes("list", "")) {
+			return nil, fmt.Errorf("access denied")
+		}
+
+		return r.store.List(), nil
+	}
+
+	log := xcontext.Logger(req.Context())
+
+	all, err := cli.List(req.Context(), dynamic.Options{
+		GVR: schema.GroupVersionResource{
+			Group:    "apiextensions.k8s.io",
+			Version:  "v1",
+			Resource: "customresourcedefinitions",
+		},
+	})
+	if err != nil {
+		log.Error("unable to list customresourcedefinitions", slog.Any("err", err))
+		writeError(wri, err)
+		return nil, err
+	}
+
+	res := make([]map[string]any, 0, len(all.Items))
+	for _, el := range all.Items {
+		res = append(res, el.Object)
+	}
+
+	return res, nil
+}
+
+func widgetInfo(crd map[string]any) (info, error) {
+	names, ok, err := maps.NestedMapNoCopy(crd, "spec", "names")
+	if err != nil {
+		return info{}, fmt.Errorf("unable to fetch spec.names in CRD: %w", err)
+	}
+	if !ok {
+		return info{}, fmt.Errorf("spec.names not found in CRD")
+	}
+
+	group := ""
+	if val, ok := maps.NestedValue(crd, []string{"spec", "group"}); ok {
+		group = val.(string)
+	}
+
+	vers, _, err := unstructured.NestedSlice(crd, "spec", "versions")
+	if err != nil {
+		return info{}, fmt.Errorf("unable to fetch spec.versions in CRD: %w", err)
+	}
+	versions := make([]string, 0, len(vers))
+	for _, vv := range vers {
+		ver, _, err := unstructured.NestedString(vv.(map[string]any), "name")
+		if err == nil {
+			versions = append(versions, ver)
+		}
+	}
+
+	plural, ok := names["plural"].(string)
+	if !ok {
+		return info{}, fmt.Errorf("spec.names.plural not found in CRD")
+	}
+	kind, ok := names["kind"].(string)
+	if !ok {
+		return info{}, fmt.Errorf("spec.names.kind not found in CRD")
+	}
+
+	return info{
+		Resource: plural,
+		Kind:     kind,
+		Group:    group,
+		Versions: versions,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/smithery/internal/readiness"
+)
+
+const readinessTimeout = 5 * time.Second
+
+// @Summary Readiness Endpoint
+// @Description Checks the service dependencies: API server reachability, access to apiextensions,
+// @Description authn clientconfig secrets namespace and JWT signing key configuration
+// @ID readyz
+// @Produce  json
+// @Success 200 {object} readyzResult
+// @Failure 503 {object} readyzResult
+// @Router /readyz [get]
+func Readyz(checks ...readiness.Check) http.Handler {
+	return &readyzHandler{
+		checks:  checks,
+		timeout: readinessTimeout,
+	}
+}
+
+var _ http.Handler = (*readyzHandler)(nil)
+
+type readyzHandler struct {
+	checks []readiness.Check
+	// timeout bounds the run of all the checks.
+	timeout time.Duration
+}
+
+type readyzResult struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+type checkResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+const (
+	checkOK     = "ok"
+	checkFailed = "failed"
+)
+
+func (r *readyzHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), r.timeout)
+	defer cancel()
+
+	res := readyzResult{
+		Status: checkOK,
+		Checks: make([]checkResult, len(r.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, chk := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := chk.Run(ctx)
+
+			res.Checks[i] = checkResult{
+				Name:     chk.Name,
+				Status:   checkOK,
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				res.Checks[i].Status = checkFailed
+				res.Checks[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for _, el := range res.Checks {
+		if el.Status != checkOK {
+			res.Status = checkFailed
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	wri.Header().Set("Content-Type", "application/json")
+	wri.Header().Set("Cache-Control", "no-store")
+	wri.WriteHeader(code)
+	json.NewEncoder(wri).Encode(&res)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/smithery/internal/readiness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyz(t *testing.T) {
+	ok := readiness.Check{Name: "apiserver", Run: func(context.Context) error { return nil }}
+	ko := readiness.SigningKey("")
+
+	tests := []struct {
+		name    string
+		checks  []readiness.Check
+		timeout time.Duration
+		code    int
+		status  []string
+		errors  []string
+	}{
+		{
+			name:   "all checks pass",
+			checks: []readiness.Check{ok},
+			code:   http.StatusOK,
+			status: []string{checkOK},
+			errors: []string{""},
+		},
+		{
+			name:   "one check fails",
+			checks: []readiness.Check{ok, ko},
+			code:   http.StatusServiceUnavailable,
+			status: []string{checkOK, checkFailed},
+			errors: []string{"", "JWT signing key not configured"},
+		},
+		{
+			name: "check honours the timeout",
+			checks: []readiness.Check{{Name: "slow", Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}}},
+			timeout: 10 * time.Millisecond,
+			code:    http.StatusServiceUnavailable,
+			status:  []string{checkFailed},
+			errors:  []string{context.DeadlineExceeded.Error()},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := Readyz(tc.checks...).(*readyzHandler)
+			if tc.timeout > 0 {
+				h.timeout = tc.timeout
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tc.code, rec.Code)
+
+			var res readyzResult
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+
+			status := make([]string, 0, len(res.Checks))
+			errs := make([]string, 0, len(res.Checks))
+			for _, el := range res.Checks {
+				status = append(status, el.Status)
+				errs = append(errs, el.Error)
+			}
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.errors, errs)
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	"github.com/krateoplatformops/smithery/internal/revisions"
+)
+
+// @Summary Schema Revisions Endpoint
+// @Description Returns the input schema revisions of a Widget, oldest first,
+// @Description or the JSON Schema of one revision when 'revision' is specified
+// @ID revisions
+// @Produce  json
+// @Param kind query string true "Widget kind (i.e. Button)"
+// @Param revision query int false "Revision number"
+// @Success 200 {array} revisions.Revision
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 404 {object} errorStatus
+// @Failure 500 {object} errorStatus
+// @Failure 503 {object} errorStatus
+// @Router /revisions [get]
+// @Security Bearer
+func Revisions(pool *dynamic.Pool, history *revisions.Store) http.Handler {
+	return &revisionsHandler{
+		pool:    pool,
+		history: history,
+	}
+}
+
+// @Summary Rollback Endpoint
+// @Description Forges, and applies, the CRD again from a stored input schema revision.
+// @Description The response is the same of /forge.
+// @ID rollback
+// @Param kind query string true "Widget kind (i.e. Button)"
+// @Param revision query int true "Revision number"
+// @Param wait query bool false "Wait for the applied CRD to be established and return its conditions"
+// @Param timeout query string false "How long to wait for the CRD to be established (default 30s)"
+// @Produce      plain
+// @Produce      json
+// @Success      200  {string}  string  "CRD YAML"
+// @Success      200  {object}  forgeResult  "CRD conditions (when wait=true)"
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 404 {object} errorStatus
+// @Failure 422 {object} errorStatus
+// @Failure 503 {object} errorStatus
+// @Failure 504 {object} errorStatus
+// @Router /revisions/rollback [post]
+// @Security Bearer
+func Rollback(pool *dynamic.Pool, history *revisions.Store, forge http.Handler) http.Handler {
+	return &revisionsHandler{
+		pool:    pool,
+		history: history,
+		forge:   forge,
+	}
+}
+
+var _ http.Handler = (*revisionsHandler)(nil)
+
+type revisionsHandler struct {
+	pool    *dynamic.Pool
+	history *revisions.Store
+	// forge, when set, re-forges the selected revision.
+	forge http.Handler
+}
+
+func (r *revisionsHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	log := xcontext.Logger(req.Context())
+
+	if r.history == nil {
+		response.ServiceUnavailable(wri, fmt.Errorf("schema revisions are disabled"))
+		return
+	}
+
+	qs := req.URL.Query()
+
+	kind := qs.Get("kind")
+	if len(kind) == 0 {
+		response.BadRequest(wri, fmt.Errorf("missing 'kind' query parameter"))
+		return
+	}
+
+	// Forge only serves the widgets group, so are the revisions.
+	group := WidgetsGroup
+
+	number := 0
+	if val := qs.Get("revision"); len(val) > 0 {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			response.BadRequest(wri, fmt.Errorf("invalid revision %q: must be a positive number", val))
+			return
+		}
+		number = n
+	}
+	if r.forge != nil && number == 0 {
+		response.BadRequest(wri, fmt.Errorf("missing 'revision' query parameter"))
+		return
+	}
+
+	ep, err := xcontext.UserConfig(req.Context())
+	if err != nil {
+		log.Error("unable to get user endpoint", slog.Any("err", err))
+		response.Unauthorized(wri, err)
+		return
+	}
+
+	cli, err := r.pool.ClientFor(req.Context(), ep)
+	if err != nil {
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
+		response.InternalError(wri, err)
+		return
+	}
+
+	if !authorize(wri, req, cli.RESTConfig(), crdAttributes("list", "")) {
+		return
+	}
+
+	if number == 0 {
+		all, err := r.history.List(req.Context(), group, kind)
+		if err != nil {
+			log.Error("unable to list schema revisions",
+				slog.String("group", group), slog.String("kind", kind), slog.Any("err", err))
+			writeError(wri, err)
+			return
+		}
+
+		wri.Header().Set("Content-Type", "application/json")
+		wri.WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(wri)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(all); err != nil {
+			log.Error("unable to serve api call response", slog.Any("err", err))
+		}
+		return
+	}
+
+	rev, dat, err := r.history.Get(req.Context(), group, kind, number)
+	if err != nil {
+		log.Error("unable to get schema revision",
+			slog.String("group", group), slog.String("kind", kind),
+			slog.Int("revision", number), slog.Any("err", err))
+		writeError(wri, err)
+		return
+	}
+
+	if r.forge == nil {
+		wri.Header().Set("Content-Type", "application/json")
+		wri.WriteHeader(http.StatusOK)
+		wri.Write(dat)
+		return
+	}
+
+	log.Info("rolling back widget schema",
+		slog.String("kind", kind), slog.Int("revision", rev.Number))
+
+	r.forge.ServeHTTP(wri, rollbackRequest(req, dat))
+}
+
+// rollbackRequest turns a rollback request into the forge
+// (with apply) request of the stored schema.
+func rollbackRequest(req *http.Request, schema []byte) *http.Request {
+	fwd := req.Clone(req.Context())
+	fwd.Method = http.MethodPost
+	fwd.Header.Set("Content-Type", "application/json")
+	fwd.Body = io.NopCloser(bytes.NewReader(schema))
+	fwd.ContentLength = int64(len(schema))
+
+	qs := fwd.URL.Query()
+	for _, key := range []string{"kind", "revision"} {
+		qs.Del(key)
+	}
+	qs.Set("apply", "true")
+	fwd.URL.RawQuery = qs.Encode()
+
+	return fwd
+}
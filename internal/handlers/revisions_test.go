@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/krateoplatformops/smithery/internal/revisions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevisionsBadRequests(t *testing.T) {
+	forge := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		query   string
+		code    int
+	}{
+		{
+			name:    "revisions disabled",
+			handler: Revisions(nil, nil),
+			query:   "kind=Button",
+			code:    http.StatusServiceUnavailable,
+		},
+		{
+			name:    "missing kind",
+			handler: Revisions(nil, &revisions.Store{}),
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "invalid revision",
+			handler: Revisions(nil, &revisions.Store{}),
+			query:   "kind=Button&revision=zero",
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "rollback without revision",
+			handler: Rollback(nil, &revisions.Store{}, forge),
+			query:   "kind=Button",
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "missing user config",
+			handler: Rollback(nil, &revisions.Store{}, forge),
+			query:   "kind=Button&revision=2",
+			code:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/revisions?"+tc.query, nil)
+			rec := httptest.NewRecorder()
+
+			tc.handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
+
+func TestRollbackRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost,
+		"/revisions/rollback?kind=Button&revision=2&wait=true&timeout=45s&apply=false", nil)
+
+	fwd := rollbackRequest(req, []byte(`{"a":1}`))
+	assert.Equal(t, http.MethodPost, fwd.Method)
+	assert.Equal(t, "application/json", fwd.Header.Get("Content-Type"))
+	assert.Equal(t, "apply=true&timeout=45s&wait=true", fwd.URL.RawQuery)
+
+	dat, err := io.ReadAll(fwd.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(dat))
+}
@@ -1,53 +1,112 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	xcontext "github.com/krateoplatformops/plumbing/context"
 	"github.com/krateoplatformops/plumbing/http/response"
-	"github.com/krateoplatformops/plumbing/kubeconfig"
 	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
 	"github.com/krateoplatformops/smithery/internal/handlers/util"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"github.com/krateoplatformops/smithery/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
 )
 
 // @Summary Fetch CRD OpenAPI Schema
-// @Description CRD OpenAPI Schema
+// @Description CRD OpenAPI Schema. Without 'version' all the served versions are returned, keyed by version name.
+// @Description With many resources (or bulk=true) the schemas are resolved concurrently and returned as a list, each item with its own error.
 // @ID schema
 // @Produce  json
-// @Param version query string true "API Version"
-// @Param resource query string true "Resource name"
+// @Produce  application/yaml
+// @Param version query string false "API Version (all served versions when missing)"
+// @Param apiVersion query string false "API Version with group (i.e. widgets.templates.krateo.io/v1beta1), alternative to version"
+// @Param resource query []string false "Resource name (repeat it, or separate names by comma, for the bulk mode, up to 50 with kind)" collectionFormat(multi)
+// @Param kind query []string false "Kind (i.e. Button), alternative to resource" collectionFormat(multi)
+// @Param bulk query bool false "Reply with a list of items even for a single resource"
+// @Param path query string false "Sub-schema JSON Pointer (/properties/spec/properties/widgetData) or dotted field path (spec.widgetData)"
+// @Param format query string false "Output format" Enums(openapi, jsonschema, openapi3)
+// @Param If-None-Match header string false "ETag of the cached copy"
 // @Success 200 {object} object
+// @Success 200 {array} schemaItem "bulk mode"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} errorStatus
+// @Failure 401 {object} errorStatus
+// @Failure 403 {object} errorStatus
+// @Failure 404 {object} errorStatus
+// @Failure 500 {object} errorStatus
 // @Router /schema [get]
 // @Security Bearer
-func Schema() http.Handler {
-	return &schemaHandler{}
+func Schema(pool *dynamic.Pool, store *crds.Cache) http.Handler {
+	return &schemaHandler{
+		pool:  pool,
+		store: store,
+	}
 }
 
 var _ http.Handler = (*schemaHandler)(nil)
 
-type schemaHandler struct{}
+type schemaHandler struct {
+	pool  *dynamic.Pool
+	store *crds.Cache
+}
+
+const (
+	formatOpenAPI    = "openapi"
+	formatJSONSchema = "jsonschema"
+	formatOpenAPI3   = "openapi3"
+
+	// maxBulkConcurrency limits the schemas resolved at the same time in bulk mode.
+	maxBulkConcurrency = 8
+	// maxBulkRefs limits the resources and kinds of a request, since each one
+	// costs CRD lookups and access reviews.
+	maxBulkRefs = 50
+)
+
+// schemaItem is the result of a single resource in bulk mode.
+type schemaItem struct {
+	Resource string       `json:"resource,omitempty"`
+	Kind     string       `json:"kind,omitempty"`
+	Version  string       `json:"version,omitempty"`
+	Schema   any          `json:"schema,omitempty"`
+	Error    *errorStatus `json:"error,omitempty"`
+}
+
+// schemaSelector tells which part of the schema to return and how.
+type schemaSelector struct {
+	path   string
+	format string
+}
 
 func (r *schemaHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
-	gvr, err := parseGVR(req)
+	sel, err := parseSchemaSelector(req)
 	if err != nil {
 		response.BadRequest(wri, err)
 		return
 	}
 
-	log := xcontext.Logger(req.Context()).
-		With(
-			slog.Group("resource",
-				slog.String("name", gvr.Resource),
-				slog.String("group", gvr.Group),
-				slog.String("version", gvr.Version),
-			),
-		)
+	refs, bulk, err := parseSchemaRefs(req)
+	if err != nil {
+		response.BadRequest(wri, err)
+		return
+	}
+
+	log := xcontext.Logger(req.Context())
 
 	start := time.Now()
 
@@ -58,71 +117,324 @@ func (r *schemaHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	rc, err := kubeconfig.NewClientConfig(req.Context(), ep)
+	cli, err := r.pool.ClientFor(req.Context(), ep)
 	if err != nil {
-		log.Error("unable to create kubernetes client config", slog.Any("err", err))
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
 		response.InternalError(wri, err)
 		return
 	}
 
-	log.Debug("fetching custom resource definition")
+	var res any
+	if bulk {
+		res = r.resolveAll(req.Context(), cli, refs, sel)
 
-	crd, err := crds.Get(req.Context(), crds.GetOptions{
-		RC:      rc,
-		Name:    gvr.GroupResource().String(),
-		Version: gvr.Version,
-	})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			response.NotFound(wri, err)
-		} else {
-			response.InternalError(wri, err)
+		log.Info("openapi schemas successfully fetched",
+			slog.Int("count", len(refs)), slog.String("duration", util.ETA(start)))
+	} else {
+		ref := refs[0]
+		log = log.With(
+			slog.Group("resource",
+				slog.String("name", ref.Resource),
+				slog.String("kind", ref.Kind),
+				slog.String("group", ref.Group),
+				slog.String("version", ref.Version),
+			),
+		)
+
+		res, err = r.resolve(req.Context(), cli, ref, sel)
+		if err != nil {
+			log.Error("unable to fetch openapi schema", slog.Any("err", err))
+			writeStatus(wri, schemaErrorStatus(err))
+			return
 		}
-		return
+
+		log.Info("openapi schema successfully fetched", slog.String("duration", util.ETA(start)))
 	}
 
-	log.Debug("fetching openapi schema")
+	contentType := util.PreferredType(req, "application/json", "application/yaml")
 
-	crv, err := crds.OpenAPISchema(crd, gvr.Version)
+	dat, err := encodeSchema(res, contentType)
 	if err != nil {
 		response.InternalError(wri, err)
 		return
 	}
 
-	log.Info("openapi schema successfully fetched", slog.String("duration", util.ETA(start)))
+	if err := util.WriteCacheable(wri, req, contentType, dat); err != nil {
+		log.Error("unable to serve openapi schema for CRD", slog.Any("err", err))
+	}
+}
+
+// resolve returns the selected schema of the specified widget or,
+// when the version is empty, the ones of all the served versions keyed by name.
+func (r *schemaHandler) resolve(ctx context.Context, cli *dynamic.UnstructuredClient, ref schemaRef, sel schemaSelector) (res any, err error) {
+	ctx, span := tracing.Start(ctx, "schema.resolve", trace.WithAttributes(
+		attribute.String("widget.name", ref.name()),
+		attribute.String("widget.group", ref.Group),
+		attribute.String("widget.version", ref.Version),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	gvr := ref.WithResource(ref.Resource)
+	if len(ref.Resource) == 0 {
+		mapped, err := cli.ResourceFor(ref.WithKind(ref.Kind))
+		if err != nil {
+			return nil, err
+		}
+		gvr.Resource = mapped.Resource
+	}
+
+	name := gvr.GroupResource().String()
+
+	var crd map[string]any
+	if r.store.Ready() {
+		if err := checkAccess(ctx, cli.RESTConfig(), crdAttributes("get", name)); err != nil {
+			return nil, err
+		}
+
+		crd, _ = r.store.Get(name)
+	}
+
+	if crd == nil {
+		xcontext.Logger(ctx).Debug("fetching custom resource definition", slog.String("name", name))
 
-	wri.Header().Set("Content-Type", "application/json")
-	wri.WriteHeader(http.StatusOK)
+		crd, err = crds.Get(ctx, crds.GetOptions{
+			Client:  cli,
+			Name:    name,
+			Version: gvr.Version,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	all, err := crds.OpenAPISchemas(crd)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, _, _ := unstructured.NestedString(crd, "spec", "names", "kind")
+
+	if len(gvr.Version) > 0 {
+		crv, ok := all[gvr.Version]
+		if !ok {
+			return nil, versionNotFound(gvr)
+		}
 
-	enc := json.NewEncoder(wri)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(crv); err != nil {
-		log.Error("unable to serve openapi schema for CRD",
-			slog.String("resource", gvr.GroupResource().String()),
-			slog.String("version", gvr.Version),
-			slog.Any("err", err))
+		return sel.apply(crv, gvr.GroupVersion().WithKind(kind))
 	}
+
+	versions := make(map[string]any, len(all))
+	for ver, crv := range all {
+		versions[ver], err = sel.apply(crv, schema.GroupVersionKind{Group: gvr.Group, Version: ver, Kind: kind})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return versions, nil
 }
 
-func parseGVR(req *http.Request) (gvr schema.GroupVersionResource, err error) {
-	ver := req.URL.Query().Get("version")
-	if len(ver) == 0 {
-		err = fmt.Errorf("missing 'version' query parameter")
-		return
+// resolveAll resolves concurrently the schemas of many resources,
+// reporting the errors item by item.
+func (r *schemaHandler) resolveAll(ctx context.Context, cli *dynamic.UnstructuredClient, refs []schemaRef, sel schemaSelector) []schemaItem {
+	log := xcontext.Logger(ctx)
+
+	res := make([]schemaItem, len(refs))
+	sem := make(chan struct{}, maxBulkConcurrency)
+
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res[i] = schemaItem{
+				Resource: ref.Resource,
+				Kind:     ref.Kind,
+				Version:  ref.Version,
+			}
+
+			crv, err := r.resolve(ctx, cli, ref, sel)
+			if err != nil {
+				log.Warn("unable to fetch openapi schema",
+					slog.String("name", ref.name()), slog.Any("err", err))
+				res[i].Error = schemaErrorStatus(err)
+				return
+			}
+			res[i].Schema = crv
+		}()
 	}
-	api := fmt.Sprintf("%s/%s", widgetsGroup, ver)
+	wg.Wait()
 
-	res := req.URL.Query().Get("resource")
-	if len(res) == 0 {
-		err = fmt.Errorf("missing 'resource' query parameter")
-		return
+	return res
+}
+
+// apply returns the part of the schema selected by path, in the requested format.
+func (s schemaSelector) apply(crv map[string]any, gvk schema.GroupVersionKind) (any, error) {
+	sub, err := crds.SubSchema(crv, s.path)
+	if err != nil {
+		return nil, err
 	}
 
-	gv, err := schema.ParseGroupVersion(api)
+	if s.format != formatJSONSchema && s.format != formatOpenAPI3 {
+		return sub, nil
+	}
+
+	obj, ok := sub.(map[string]any)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("path %q does not select a schema", s.path))
+	}
+
+	if s.format == formatJSONSchema {
+		return crds.ToJSONSchema(obj), nil
+	}
+
+	return crds.ToOpenAPI3(obj, gvk.Group, gvk.Version, gvk.Kind), nil
+}
+
+func parseSchemaSelector(req *http.Request) (schemaSelector, error) {
+	sel := schemaSelector{
+		path:   req.URL.Query().Get("path"),
+		format: req.URL.Query().Get("format"),
+	}
+
+	switch sel.format {
+	case "", formatOpenAPI, formatJSONSchema, formatOpenAPI3:
+		return sel, nil
+	default:
+		return sel, fmt.Errorf("invalid 'format' query parameter %q, must be one of: %s, %s, %s",
+			sel.format, formatOpenAPI, formatJSONSchema, formatOpenAPI3)
+	}
+}
+
+// schemaErrorStatus maps the errors of resolve to a status with the matching HTTP code.
+func schemaErrorStatus(err error) *errorStatus {
+	var pnf *crds.PathNotFoundError
+	if errors.As(err, &pnf) {
+		return newErrorStatus(http.StatusNotFound, err)
+	}
+
+	if meta.IsNoMatchError(err) {
+		return newErrorStatus(http.StatusNotFound, err)
+	}
+
+	return apiErrorStatus(err)
+}
+
+func versionNotFound(gvr schema.GroupVersionResource) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotFound,
+		Reason:  metav1.StatusReasonNotFound,
+		Message: fmt.Sprintf("version %q of %q not found", gvr.Version, gvr.GroupResource().String()),
+		Details: &metav1.StatusDetails{
+			Group: gvr.Group,
+			Kind:  gvr.Resource,
+		},
+	}}
+}
+
+func encodeSchema(v any, contentType string) ([]byte, error) {
+	dat, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		return gvr, err
+		return nil, err
+	}
+
+	if contentType == "application/yaml" {
+		return yaml.JSONToYAML(dat)
+	}
+
+	return append(dat, '\n'), nil
+}
+
+// schemaRef identifies a widget by resource or by kind.
+type schemaRef struct {
+	schema.GroupVersion
+	Resource string
+	Kind     string
+}
+
+func (r schemaRef) name() string {
+	if len(r.Resource) > 0 {
+		return r.Resource
+	}
+	return r.Kind
+}
+
+// parseSchemaRefs returns the widgets requested with the 'resource' or 'kind' query
+// parameters, repeated or comma separated; bulk is true when they are more than one
+// (or bulk=true). The API group defaults to the widgets one, unless specified with
+// a full 'apiVersion' (i.e. 'widgets.templates.krateo.io/v1beta1').
+func parseSchemaRefs(req *http.Request) (refs []schemaRef, bulk bool, err error) {
+	gv, err := parseGroupVersion(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	values := func(key string) (all []string) {
+		for _, val := range req.URL.Query()[key] {
+			for _, el := range strings.Split(val, ",") {
+				if el = strings.TrimSpace(el); len(el) > 0 {
+					all = append(all, el)
+				}
+			}
+		}
+		return all
+	}
+
+	for _, res := range values("resource") {
+		refs = append(refs, schemaRef{GroupVersion: gv, Resource: res})
+	}
+	for _, kind := range values("kind") {
+		refs = append(refs, schemaRef{GroupVersion: gv, Kind: kind})
+	}
+
+	if len(refs) == 0 {
+		return nil, false, fmt.Errorf("missing 'resource' or 'kind' query parameter")
+	}
+	if len(refs) > maxBulkRefs {
+		return nil, false, fmt.Errorf("too many 'resource' and 'kind' query parameters: %d, at most %d are allowed",
+			len(refs), maxBulkRefs)
+	}
+
+	bulk = len(refs) > 1
+	if val := req.URL.Query().Get("bulk"); len(val) > 0 {
+		ok, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid 'bulk' query parameter: %w", err)
+		}
+		bulk = bulk || ok
+	}
+
+	return refs, bulk, nil
+}
+
+func parseGroupVersion(req *http.Request) (schema.GroupVersion, error) {
+	gv := schema.GroupVersion{
+		Group:   WidgetsGroup,
+		Version: req.URL.Query().Get("version"),
+	}
+
+	api := req.URL.Query().Get("apiVersion")
+	if len(api) == 0 {
+		return gv, nil
+	}
+
+	if len(gv.Version) > 0 {
+		return gv, fmt.Errorf("'apiVersion' and 'version' query parameters are mutually exclusive")
+	}
+
+	val, err := schema.ParseGroupVersion(api)
+	if err != nil {
+		return gv, fmt.Errorf("invalid 'apiVersion' query parameter: %w", err)
+	}
+	if len(val.Group) > 0 {
+		gv.Group = val.Group
 	}
+	gv.Version = val.Version
 
-	gvr = gv.WithResource(res)
-	return
+	return gv, nil
 }
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseSchemaRefs(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []schemaRef
+		bulk    bool
+		wantErr bool
+	}{
+		{
+			query: "version=v1beta1&resource=buttons",
+			want: []schemaRef{
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup, Version: "v1beta1"}, Resource: "buttons"},
+			},
+		},
+		{
+			query: "resource=buttons",
+			want: []schemaRef{
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup}, Resource: "buttons"},
+			},
+		},
+		{
+			query: "kind=Button&apiVersion=v1beta1",
+			want: []schemaRef{
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup, Version: "v1beta1"}, Kind: "Button"},
+			},
+		},
+		{
+			query: "kind=Panel&apiVersion=custom.widgets.example.io/v1",
+			want: []schemaRef{
+				{GroupVersion: schema.GroupVersion{Group: "custom.widgets.example.io", Version: "v1"}, Kind: "Panel"},
+			},
+		},
+		{
+			query: "resource=buttons&bulk=true",
+			want: []schemaRef{
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup}, Resource: "buttons"},
+			},
+			bulk: true,
+		},
+		{
+			query: "resource=buttons,tables&kind=Panel",
+			want: []schemaRef{
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup}, Resource: "buttons"},
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup}, Resource: "tables"},
+				{GroupVersion: schema.GroupVersion{Group: WidgetsGroup}, Kind: "Panel"},
+			},
+			bulk: true,
+		},
+		{
+			query:   "version=v1beta1",
+			wantErr: true,
+		},
+		{
+			query:   "resource=buttons&bulk=maybe",
+			wantErr: true,
+		},
+		{
+			query:   "kind=Button&version=v1&apiVersion=widgets.templates.krateo.io/v1",
+			wantErr: true,
+		},
+		{
+			query:   "kind=Button&apiVersion=a/b/c",
+			wantErr: true,
+		},
+		{
+			query:   "kind=Button&resource=" + strings.Repeat("buttons,", maxBulkRefs),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/schema?"+tc.query, nil)
+
+			got, bulk, err := parseSchemaRefs(req)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.bulk, bulk)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSchemaErrorStatus(t *testing.T) {
+	gr := schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "missing path segment",
+			err:  &crds.PathNotFoundError{Path: "spec.foo", Segment: "foo"},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "missing crd",
+			err:  fmt.Errorf("wrapped: %w", apierrors.NewNotFound(gr, "buttons.widgets.templates.krateo.io")),
+			want: http.StatusNotFound,
+		},
+		{
+			name: "forbidden",
+			err:  apierrors.NewForbidden(gr, "buttons.widgets.templates.krateo.io", fmt.Errorf("no way")),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "unknown kind",
+			err:  &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: WidgetsGroup, Kind: "Nope"}},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "anything else",
+			err:  fmt.Errorf("boom"),
+			want: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, schemaErrorStatus(tc.err).Code)
+		})
+	}
+}
+
+func TestSchemaSelectorApply(t *testing.T) {
+	crv := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"spec": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"widgetData": map[string]any{"type": "object", "nullable": true},
+				},
+			},
+		},
+	}
+	gvk := schema.GroupVersionKind{Group: WidgetsGroup, Version: "v1beta1", Kind: "Button"}
+
+	got, err := schemaSelector{path: "spec.widgetData"}.apply(crv, gvk)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"type": "object", "nullable": true}, got)
+
+	got, err = schemaSelector{path: "spec.widgetData", format: formatJSONSchema}.apply(crv, gvk)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"object", "null"}, got.(map[string]any)["type"])
+
+	_, err = schemaSelector{path: "/properties/spec/type", format: formatJSONSchema}.apply(crv, gvk)
+	assert.Equal(t, http.StatusBadRequest, schemaErrorStatus(err).Code)
+}
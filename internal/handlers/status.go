@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/krateoplatformops/plumbing/http/response"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// errorStatus is the error response of the handlers: a response.Status with,
+// for the Kubernetes API errors, the details of the failure passed through
+// (i.e. the field-level causes of an Invalid CRD).
+type errorStatus struct {
+	response.Status
+	Details *metav1.StatusDetails `json:"details,omitempty"`
+}
+
+// newErrorStatus returns a status without details.
+func newErrorStatus(code int, err error) *errorStatus {
+	return &errorStatus{Status: *response.New(code, err)}
+}
+
+// reasonCodes are the HTTP codes of the Kubernetes status reasons, used
+// when the API server does not specify one.
+var reasonCodes = map[metav1.StatusReason]int{
+	metav1.StatusReasonBadRequest:            http.StatusBadRequest,
+	metav1.StatusReasonUnauthorized:          http.StatusUnauthorized,
+	metav1.StatusReasonForbidden:             http.StatusForbidden,
+	metav1.StatusReasonNotFound:              http.StatusNotFound,
+	metav1.StatusReasonMethodNotAllowed:      http.StatusMethodNotAllowed,
+	metav1.StatusReasonNotAcceptable:         http.StatusNotAcceptable,
+	metav1.StatusReasonAlreadyExists:         http.StatusConflict,
+	metav1.StatusReasonConflict:              http.StatusConflict,
+	metav1.StatusReasonGone:                  http.StatusGone,
+	metav1.StatusReasonExpired:               http.StatusGone,
+	metav1.StatusReasonRequestEntityTooLarge: http.StatusRequestEntityTooLarge,
+	metav1.StatusReasonUnsupportedMediaType:  http.StatusUnsupportedMediaType,
+	metav1.StatusReasonInvalid:               http.StatusUnprocessableEntity,
+	metav1.StatusReasonTooManyRequests:       http.StatusTooManyRequests,
+	metav1.StatusReasonInternalError:         http.StatusInternalServerError,
+	metav1.StatusReasonServiceUnavailable:    http.StatusServiceUnavailable,
+	metav1.StatusReasonTimeout:               http.StatusGatewayTimeout,
+	metav1.StatusReasonServerTimeout:         http.StatusGatewayTimeout,
+}
+
+// apiErrorStatus maps a Kubernetes API error to a status with its HTTP code,
+// reason and details; any other error is an internal error.
+func apiErrorStatus(err error) *errorStatus {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return newErrorStatus(http.StatusInternalServerError, err)
+	}
+
+	st := status.Status()
+
+	code := int(st.Code)
+	if code == 0 {
+		code = reasonCodes[st.Reason]
+	}
+	if code < http.StatusBadRequest {
+		code = http.StatusInternalServerError
+	}
+
+	res := newErrorStatus(code, err)
+	res.Status.Status = response.StatusFailure
+	if len(st.Reason) > 0 {
+		res.Reason = response.StatusReason(st.Reason)
+	}
+	res.Details = st.Details
+
+	return res
+}
+
+// writeStatus writes the status with its HTTP code.
+func writeStatus(wri http.ResponseWriter, status *errorStatus) error {
+	wri.Header().Set("Content-Type", "application/json")
+	wri.WriteHeader(status.Code)
+	return json.NewEncoder(wri).Encode(status)
+}
+
+// writeError writes the status of a Kubernetes API error, see apiErrorStatus.
+func writeError(wri http.ResponseWriter, err error) error {
+	return writeStatus(wri, apiErrorStatus(err))
+}
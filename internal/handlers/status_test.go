@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestAPIErrorStatus(t *testing.T) {
+	gr := schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+
+	tests := []struct {
+		name   string
+		err    error
+		code   int
+		reason response.StatusReason
+	}{
+		{
+			name:   "forbidden",
+			err:    apierrors.NewForbidden(gr, "buttons.widgets.templates.krateo.io", errors.New("no RBAC policy matched")),
+			code:   http.StatusForbidden,
+			reason: response.StatusReasonForbidden,
+		},
+		{
+			name:   "conflict",
+			err:    apierrors.NewConflict(gr, "buttons.widgets.templates.krateo.io", errors.New("object has been modified")),
+			code:   http.StatusConflict,
+			reason: response.StatusReasonConflict,
+		},
+		{
+			name:   "already exists",
+			err:    apierrors.NewAlreadyExists(gr, "buttons.widgets.templates.krateo.io"),
+			code:   http.StatusConflict,
+			reason: "AlreadyExists",
+		},
+		{
+			name: "invalid",
+			err: apierrors.NewInvalid(schema.GroupKind{Group: gr.Group, Kind: "CustomResourceDefinition"}, "buttons.widgets.templates.krateo.io",
+				field.ErrorList{field.Required(field.NewPath("spec", "versions"), "")}),
+			code:   http.StatusUnprocessableEntity,
+			reason: response.StatusReasonInvalid,
+		},
+		{
+			name:   "too many requests",
+			err:    apierrors.NewTooManyRequests("slow down", 1),
+			code:   http.StatusTooManyRequests,
+			reason: response.StatusReasonTooManyRequests,
+		},
+		{
+			name:   "server timeout",
+			err:    apierrors.NewServerTimeout(gr, "create", 1),
+			code:   http.StatusInternalServerError,
+			reason: "ServerTimeout",
+		},
+		{
+			name:   "reason without code",
+			err:    &apierrors.StatusError{ErrStatus: metav1.Status{Reason: metav1.StatusReasonTimeout, Message: "too slow"}},
+			code:   http.StatusGatewayTimeout,
+			reason: response.StatusReasonTimeout,
+		},
+		{
+			name:   "wrapped",
+			err:    fmt.Errorf("unable to apply: %w", apierrors.NewUnauthorized("token expired")),
+			code:   http.StatusUnauthorized,
+			reason: response.StatusReasonUnauthorized,
+		},
+		{
+			name:   "other",
+			err:    errors.New("boom"),
+			code:   http.StatusInternalServerError,
+			reason: response.StatusReasonInternalError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := apiErrorStatus(tc.err)
+			assert.Equal(t, tc.code, got.Code)
+			assert.Equal(t, tc.reason, got.Reason)
+			assert.Equal(t, response.StatusFailure, got.Status.Status)
+			assert.Equal(t, tc.err.Error(), got.Message)
+		})
+	}
+}
+
+func TestWriteErrorCauses(t *testing.T) {
+	err := apierrors.NewInvalid(
+		schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+		"buttons.widgets.templates.krateo.io",
+		field.ErrorList{
+			field.Invalid(field.NewPath("spec", "validation", "openAPIV3Schema", "properties[spec]", "properties[label]", "type"),
+				"strng", "must be string"),
+		})
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, writeError(rec, fmt.Errorf("unable to apply CRD: %w", err)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got metav1.Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, metav1.StatusReasonInvalid, got.Reason)
+	assert.Equal(t, int32(http.StatusUnprocessableEntity), got.Code)
+	require.NotNil(t, got.Details)
+	assert.Equal(t, "buttons.widgets.templates.krateo.io", got.Details.Name)
+	require.Len(t, got.Details.Causes, 1)
+	assert.Equal(t, metav1.CauseTypeFieldValueInvalid, got.Details.Causes[0].Type)
+	assert.Equal(t, "spec.validation.openAPIV3Schema.properties[spec].properties[label].type", got.Details.Causes[0].Field)
+}
+
+func TestCRDName(t *testing.T) {
+	tests := map[string]string{
+		"Button":   "buttons",
+		"Policy":   "policies",
+		"Box":      "boxes",
+		"Index":    "indices",
+		"Person":   "people",
+		"Child":    "children",
+		"Matrix":   "matrices",
+		"Quiz":     "quizzes",
+		"Series":   "series",
+		"Analysis": "analyses",
+		"Datum":    "data",
+		"Leaf":     "leaves",
+		"Status":   "statuses",
+	}
+
+	for kind, plural := range tests {
+		t.Run(kind, func(t *testing.T) {
+			assert.Equal(t, plural+"."+WidgetsGroup, crdName(kind))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PreferredType returns the offered media type the client prefers, according
+// to the Accept request header. It defaults to the first offer when the header
+// is missing or nothing matches.
+func PreferredType(req *http.Request, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	best, bestQ := offers[0], -1.0
+	for _, el := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(el))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if val, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(val, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ || q == 0 {
+			continue
+		}
+
+		for _, offer := range offers {
+			if matchMediaType(mediaType, offer) {
+				best, bestQ = offer, q
+				break
+			}
+		}
+	}
+
+	return best
+}
+
+func matchMediaType(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferredType(t *testing.T) {
+	offers := []string{"application/json", "application/yaml"}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: "application/json"},
+		{accept: "*/*", want: "application/json"},
+		{accept: "application/yaml", want: "application/yaml"},
+		{accept: "text/html, application/yaml;q=0.9", want: "application/yaml"},
+		{accept: "application/json;q=0.5, application/yaml", want: "application/yaml"},
+		{accept: "application/yaml;q=0.5, application/json", want: "application/json"},
+		{accept: "application/yaml;q=0", want: "application/json"},
+		{accept: "text/html", want: "application/json"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/schema", nil)
+			req.Header.Set("Accept", tc.accept)
+
+			assert.Equal(t, tc.want, PreferredType(req, offers...))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// CacheControl lets only the browsers store the responses, which depend on
+// the user credentials, and forces them to revalidate on every use.
+const CacheControl = "private, no-cache"
+
+// ETag returns a strong entity tag for the specified content.
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified reports whether the If-None-Match request header matches etag.
+func NotModified(req *http.Request, etag string) bool {
+	inm := req.Header.Get("If-None-Match")
+	if len(inm) == 0 {
+		return false
+	}
+
+	for _, el := range strings.Split(inm, ",") {
+		el = strings.TrimSpace(el)
+		if el == "*" {
+			return true
+		}
+		// If-None-Match uses the weak comparison.
+		if strings.TrimPrefix(el, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteCacheable writes the response body together with the ETag and Cache-Control
+// headers, or just a 304 status when the client copy is still current.
+func WriteCacheable(wri http.ResponseWriter, req *http.Request, contentType string, body []byte) error {
+	etag := ETag(body)
+
+	wri.Header().Set("ETag", etag)
+	wri.Header().Set("Cache-Control", CacheControl)
+	wri.Header().Set("Vary", "Accept")
+
+	if NotModified(req, etag) {
+		wri.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	wri.Header().Set("Content-Type", contentType)
+	wri.WriteHeader(http.StatusOK)
+	_, err := wri.Write(body)
+	return err
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCacheable(t *testing.T) {
+	body := []byte(`{"type":"object"}`)
+	etag := ETag(body)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "no validator", want: http.StatusOK},
+		{name: "matching etag", ifNoneMatch: etag, want: http.StatusNotModified},
+		{name: "weak matching etag", ifNoneMatch: "W/" + etag, want: http.StatusNotModified},
+		{name: "one of many", ifNoneMatch: `"abc", ` + etag, want: http.StatusNotModified},
+		{name: "wildcard", ifNoneMatch: "*", want: http.StatusNotModified},
+		{name: "stale etag", ifNoneMatch: `"abc"`, want: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/schema", nil)
+			if len(tc.ifNoneMatch) > 0 {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+
+			rec := httptest.NewRecorder()
+			require.NoError(t, WriteCacheable(rec, req, "application/json", body))
+
+			assert.Equal(t, tc.want, rec.Code)
+			assert.Equal(t, etag, rec.Header().Get("ETag"))
+			assert.Equal(t, CacheControl, rec.Header().Get("Cache-Control"))
+			if tc.want == http.StatusOK {
+				assert.Equal(t, body, rec.Body.Bytes())
+			} else {
+				assert.Empty(t, rec.Body.Bytes())
+			}
+		})
+	}
+}
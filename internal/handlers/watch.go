@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	watchKeepAlive = 15 * time.Second
+)
+
+// @Summary Watch Endpoint
+// @Description Streams Server-Sent Events when widget CRDs are added, updated or deleted.
+// @Description Each event carries the same payload as a /list item; the event id is the
+// @Description CRD resourceVersion and can be sent back as Last-Event-ID to resume.
+// @ID watch
+// @Produce  text/event-stream
+// @Param Last-Event-ID header string false "resourceVersion to resume from"
+// @Success 200 {object} info
+// @Failure 401 {object} errorStatus
+// @Failure 410 {object} errorStatus
+// @Failure 500 {object} errorStatus
+// @Router /watch [get]
+// @Security Bearer
+func Watch(pool *dynamic.Pool) http.Handler {
+	return &watchHandler{
+		pool: pool,
+	}
+}
+
+var _ http.Handler = (*watchHandler)(nil)
+
+type watchHandler struct {
+	pool *dynamic.Pool
+}
+
+func (r *watchHandler) ServeHTTP(wri http.ResponseWriter, req *http.Request) {
+	log := xcontext.Logger(req.Context())
+
+	ep, err := xcontext.UserConfig(req.Context())
+	if err != nil {
+		log.Error("unable to get user endpoint", slog.Any("err", err))
+		response.Unauthorized(wri, err)
+		return
+	}
+
+	cli, err := r.pool.ClientFor(req.Context(), ep)
+	if err != nil {
+		log.Error("unable to create kubernetes client", slog.Any("err", err))
+		response.InternalError(wri, err)
+		return
+	}
+
+	lastEventId := req.Header.Get("Last-Event-ID")
+
+	w, err := cli.Watch(req.Context(), metav1.ListOptions{
+		ResourceVersion:     lastEventId,
+		AllowWatchBookmarks: true,
+	}, dynamic.Options{
+		GVR: schema.GroupVersionResource{
+			Group:    "apiextensions.k8s.io",
+			Version:  "v1",
+			Resource: "customresourcedefinitions",
+		},
+	})
+	if err != nil {
+		log.Error("unable to watch customresourcedefinitions", slog.Any("err", err))
+		writeError(wri, err)
+		return
+	}
+	defer w.Stop()
+
+	// The stream outlives the server WriteTimeout, so lift the deadline.
+	ctl := http.NewResponseController(wri)
+	if err := ctl.SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("unable to clear write deadline", slog.Any("err", err))
+	}
+
+	wri.Header().Set("Content-Type", "text/event-stream")
+	wri.Header().Set("Cache-Control", "no-cache")
+	wri.Header().Set("Connection", "keep-alive")
+	wri.Header().Set("X-Accel-Buffering", "no")
+	wri.WriteHeader(http.StatusOK)
+	ctl.Flush()
+
+	log.Info("watching widget CRDs", slog.String("resourceVersion", lastEventId))
+
+	tick := time.NewTicker(watchKeepAlive)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			log.Debug("watch client disconnected")
+			return
+
+		case <-tick.C:
+			if _, err := io.WriteString(wri, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				log.Debug("watch channel closed by the API server")
+				return
+			}
+
+			if err := writeWatchEvent(wri, ev); err != nil {
+				log.Warn("unable to send watch event", slog.Any("err", err))
+				return
+			}
+
+			if ev.Type == watch.Error {
+				return
+			}
+		}
+
+		if err := ctl.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeWatchEvent encodes a single Kubernetes watch event as an SSE message.
+// Bookmarks and CRDs outside the widgets group only advance the event id.
+func writeWatchEvent(w io.Writer, ev watch.Event) error {
+	if ev.Type == watch.Error {
+		status := metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: "unexpected error while watching widget CRDs",
+		}
+		if se, ok := apierrors.FromObject(ev.Object).(apierrors.APIStatus); ok {
+			status = se.Status()
+		}
+
+		dat, err := json.Marshal(&status)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", dat)
+		return err
+	}
+
+	uns, ok := ev.Object.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected watch object type %T", ev.Object)
+	}
+
+	name := ""
+	switch ev.Type {
+	case watch.Added:
+		name = "added"
+	case watch.Modified:
+		name = "updated"
+	case watch.Deleted:
+		name = "deleted"
+	}
+
+	group, _, _ := unstructured.NestedString(uns.Object, "spec", "group")
+	if len(name) == 0 || group != WidgetsGroup {
+		_, err := fmt.Fprintf(w, "id: %s\n\n", uns.GetResourceVersion())
+		return err
+	}
+
+	nfo, err := widgetInfo(uns.Object)
+	if err != nil {
+		return err
+	}
+
+	dat, err := json.Marshal(&nfo)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n",
+		uns.GetResourceVersion(), name, dat)
+	return err
+}
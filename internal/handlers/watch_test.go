@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestWriteWatchEvent(t *testing.T) {
+	newCRD := func(group string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]any{
+				"name":            "buttons." + group,
+				"resourceVersion": "42",
+			},
+			"spec": map[string]any{
+				"group": group,
+				"names": map[string]any{
+					"kind":   "Button",
+					"plural": "buttons",
+				},
+				"versions": []any{
+					map[string]any{"name": "v1beta1"},
+				},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name  string
+		event watch.Event
+		want  string
+	}{
+		{
+			name:  "added widget",
+			event: watch.Event{Type: watch.Added, Object: newCRD(WidgetsGroup)},
+			want:  "id: 42\nevent: added\ndata: {\"resource\":\"buttons\",\"kind\":\"Button\",\"versions\":[\"v1beta1\"],\"group\":\"widgets.templates.krateo.io\"}\n\n",
+		},
+		{
+			name:  "modified widget",
+			event: watch.Event{Type: watch.Modified, Object: newCRD(WidgetsGroup)},
+			want:  "id: 42\nevent: updated\ndata: {\"resource\":\"buttons\",\"kind\":\"Button\",\"versions\":[\"v1beta1\"],\"group\":\"widgets.templates.krateo.io\"}\n\n",
+		},
+		{
+			name:  "deleted widget",
+			event: watch.Event{Type: watch.Deleted, Object: newCRD(WidgetsGroup)},
+			want:  "id: 42\nevent: deleted\ndata: {\"resource\":\"buttons\",\"kind\":\"Button\",\"versions\":[\"v1beta1\"],\"group\":\"widgets.templates.krateo.io\"}\n\n",
+		},
+		{
+			name:  "CRD outside the widgets group",
+			event: watch.Event{Type: watch.Added, Object: newCRD("example.org")},
+			want:  "id: 42\n\n",
+		},
+		{
+			name:  "bookmark",
+			event: watch.Event{Type: watch.Bookmark, Object: newCRD(WidgetsGroup)},
+			want:  "id: 42\n\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeWatchEvent(&buf, tc.event)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		gone := apierrors.NewResourceExpired("too old resource version")
+		status := gone.Status()
+
+		var buf bytes.Buffer
+		err := writeWatchEvent(&buf, watch.Event{Type: watch.Error, Object: &status})
+		assert.NoError(t, err)
+		assert.Contains(t, buf.String(), "event: error\ndata: ")
+		assert.Contains(t, buf.String(), `"code":410`)
+	})
+
+	t.Run("unexpected object", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeWatchEvent(&buf, watch.Event{Type: watch.Added,
+			Object: &unstructured.UnstructuredList{}})
+		assert.Error(t, err)
+		assert.Equal(t, 0, buf.Len())
+	})
+}
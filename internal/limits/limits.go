@@ -0,0 +1,229 @@
+package limits
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// BodySize limits the request bodies to max bytes: the requests declaring a
+// longer body are rejected with 413, the others fail reading past the limit
+// with a *http.MaxBytesError. A non positive max disables the limit.
+func BodySize(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(wri http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > max {
+				TooLarge(wri, &http.MaxBytesError{Limit: max})
+				return
+			}
+
+			req.Body = http.MaxBytesReader(wri, req.Body, max)
+			next.ServeHTTP(wri, req)
+		})
+	}
+}
+
+// TooLarge writes a 413 Request Entity Too Large status.
+func TooLarge(wri http.ResponseWriter, err error) error {
+	return response.Encode(wri, response.New(http.StatusRequestEntityTooLarge, err))
+}
+
+// ParseBodySizes parses a comma separated list of 'route=size' pairs,
+// with sizes as Kubernetes quantities (i.e. '/forge=512Ki,/revisions/rollback=4Ki').
+func ParseBodySizes(s string) (map[string]int64, error) {
+	res := map[string]int64{}
+	for _, el := range strings.Split(s, ",") {
+		if el = strings.TrimSpace(el); len(el) == 0 {
+			continue
+		}
+
+		route, size, ok := strings.Cut(el, "=")
+		if !ok || len(strings.TrimSpace(route)) == 0 {
+			return nil, fmt.Errorf("invalid body size %q, must be 'route=size'", el)
+		}
+
+		n, err := ParseSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body size of %q: %w", route, err)
+		}
+		res[strings.TrimSpace(route)] = n
+	}
+
+	return res, nil
+}
+
+// ParseRoutes parses a comma separated list of routes (i.e. '/forge,/revisions/rollback').
+func ParseRoutes(s string) map[string]bool {
+	res := map[string]bool{}
+	for _, el := range strings.Split(s, ",") {
+		if el = strings.TrimSpace(el); len(el) > 0 {
+			res[el] = true
+		}
+	}
+	return res
+}
+
+// ParseSize parses a size in bytes expressed as a Kubernetes quantity (i.e. '1Mi').
+func ParseSize(s string) (int64, error) {
+	q, err := resource.ParseQuantity(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return q.Value(), nil
+}
+
+// RateOptions configures the per-user rate limiter.
+type RateOptions struct {
+	// Rate is the number of requests per second refilling each user bucket.
+	Rate float64
+	// Burst is the size of each user bucket.
+	Burst int
+	// TTL is how long the bucket of an idle user is kept.
+	TTL time.Duration
+}
+
+// RateLimiter limits the requests of each authenticated user with a token bucket.
+type RateLimiter struct {
+	opts RateOptions
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	// now is replaced by tests.
+	now func() time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter returns a per-user rate limiter, nil when opts.Rate is not positive.
+func NewRateLimiter(opts RateOptions) *RateLimiter {
+	if opts.Rate <= 0 {
+		return nil
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = int(math.Ceil(opts.Rate))
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Minute
+	}
+
+	return &RateLimiter{
+		opts:    opts,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Handler rejects with 429 and a Retry-After header the requests of the users
+// that exhausted their bucket. It must follow the middleware authenticating
+// the user; the requests without a user are not limited.
+// It is safe to call on a nil *RateLimiter, which limits nothing.
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(wri http.ResponseWriter, req *http.Request) {
+		user := userOf(req)
+		if len(user) == 0 {
+			next.ServeHTTP(wri, req)
+			return
+		}
+
+		if wait, ok := l.Allow(user); !ok {
+			xcontext.Logger(req.Context()).Warn("rate limit exceeded",
+				slog.String("user", user), slog.String("retryAfter", wait.String()))
+
+			secs := int(math.Ceil(wait.Seconds()))
+			if secs < 1 {
+				secs = 1
+			}
+
+			wri.Header().Set("Retry-After", strconv.Itoa(secs))
+			status := response.New(http.StatusTooManyRequests,
+				fmt.Errorf("rate limit exceeded for user %q, retry in %ds", user, secs))
+			status.Status = response.StatusFailure
+			status.Reason = response.StatusReasonTooManyRequests
+			response.Encode(wri, status)
+			return
+		}
+
+		next.ServeHTTP(wri, req)
+	})
+}
+
+// Allow takes a token from the bucket of the user; when it is empty it
+// returns how long to wait for the next one.
+func (l *RateLimiter) Allow(user string) (time.Duration, bool) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[user]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.opts.Rate), l.opts.Burst)}
+		l.buckets[user] = b
+	}
+	b.lastSeen = now
+
+	res := b.limiter.ReserveN(now, 1)
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return delay, false
+	}
+
+	return 0, true
+}
+
+// Len returns the number of users with a bucket.
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep drops, at most once per TTL, the buckets of the idle users.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.opts.TTL {
+		return
+	}
+	l.lastSweep = now
+
+	for user, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.opts.TTL {
+			delete(l.buckets, user)
+		}
+	}
+}
+
+// userOf returns the name of the authenticated user, if any.
+func userOf(req *http.Request) string {
+	if ep, err := xcontext.UserConfig(req.Context()); err == nil && len(ep.Username) > 0 {
+		return ep.Username
+	}
+	if ui, err := xcontext.UserInfo(req.Context()); err == nil {
+		return ui.Username
+	}
+	return ""
+}
@@ -0,0 +1,157 @@
+package limits
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/krateoplatformops/plumbing/endpoints"
+	"github.com/krateoplatformops/plumbing/http/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodySize(t *testing.T) {
+	echo := http.HandlerFunc(func(wri http.ResponseWriter, req *http.Request) {
+		if _, err := io.ReadAll(req.Body); err != nil {
+			var mbe *http.MaxBytesError
+			require.True(t, errors.As(err, &mbe))
+			TooLarge(wri, err)
+			return
+		}
+		wri.WriteHeader(http.StatusOK)
+	})
+
+	h := BodySize(8)(echo)
+
+	tests := []struct {
+		name   string
+		body   string
+		length int64
+		want   int
+	}{
+		{name: "within", body: "12345678", length: 8, want: http.StatusOK},
+		{name: "declared", body: "123456789", length: 9, want: http.StatusRequestEntityTooLarge},
+		{name: "chunked", body: "123456789", length: -1, want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/forge", strings.NewReader(tc.body))
+			req.ContentLength = tc.length
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tc.want, rec.Code)
+		})
+	}
+
+	assert.NotNil(t, BodySize(0)(echo))
+}
+
+func TestParseBodySizes(t *testing.T) {
+	got, err := ParseBodySizes(" /forge=512Ki, /revisions/rollback=4Ki ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"/forge":              512 * 1024,
+		"/revisions/rollback": 4 * 1024,
+	}, got)
+
+	got, err = ParseBodySizes("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = ParseBodySizes("/forge")
+	assert.Error(t, err)
+
+	_, err = ParseBodySizes("/forge=lots")
+	assert.Error(t, err)
+}
+
+func TestParseRoutes(t *testing.T) {
+	assert.Equal(t, map[string]bool{
+		"/forge":              true,
+		"/revisions/rollback": true,
+	}, ParseRoutes(" /forge, /revisions/rollback ,"))
+
+	assert.Empty(t, ParseRoutes(""))
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := NewRateLimiter(RateOptions{Rate: 1, Burst: 2, TTL: time.Minute})
+	l.now = func() time.Time { return now }
+
+	for range 2 {
+		_, ok := l.Allow("cyberjoker")
+		assert.True(t, ok)
+	}
+
+	wait, ok := l.Allow("cyberjoker")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// Buckets are per user.
+	_, ok = l.Allow("admin")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = l.Allow("cyberjoker")
+	assert.True(t, ok)
+	assert.Equal(t, 2, l.Len())
+
+	// Idle users are swept.
+	now = now.Add(2 * time.Minute)
+	_, ok = l.Allow("admin")
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestRateLimiterHandler(t *testing.T) {
+	l := NewRateLimiter(RateOptions{Rate: 0.5, Burst: 1})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	h := l.Handler(http.HandlerFunc(func(wri http.ResponseWriter, req *http.Request) {
+		wri.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/forge", nil)
+		if len(user) > 0 {
+			req = req.WithContext(xcontext.BuildContext(req.Context(),
+				xcontext.WithUserConfig(endpoints.Endpoint{Username: user})))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve("cyberjoker").Code)
+
+	rec := serve("cyberjoker")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	var status response.Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	assert.Equal(t, response.StatusReasonTooManyRequests, status.Reason)
+
+	// Anonymous requests are not limited.
+	assert.Equal(t, http.StatusOK, serve("").Code)
+	assert.Equal(t, http.StatusOK, serve("").Code)
+
+	// A nil limiter limits nothing.
+	var none *RateLimiter
+	assert.Nil(t, NewRateLimiter(RateOptions{}))
+	rec = httptest.NewRecorder()
+	none.Handler(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+const namespace = "smithery"
+
+// Forge pipeline stages.
+const (
+	StageGenerate  = "generate"
+	StageApply     = "apply"
+	StageEstablish = "establish"
+)
+
+// Forge outcomes (error classes).
+const (
+	OutcomeSuccess          = "success"
+	OutcomeInvalidRequest   = "invalid_request"
+	OutcomeForbidden        = "forbidden"
+	OutcomeGenerateError    = "generate_error"
+	OutcomeApplyError       = "apply_error"
+	OutcomeNamesNotAccepted = "names_not_accepted"
+	OutcomeTimeout          = "timeout"
+	OutcomeNotEstablished   = "not_established"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latencies by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	forgeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "forge",
+		Name:      "stage_duration_seconds",
+		Help:      "Duration of the forge pipeline stages (generate, apply, establish).",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"stage"})
+
+	forgeOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "forge",
+		Name:      "requests_total",
+		Help:      "Number of forge requests by outcome.",
+	}, []string{"outcome"})
+
+	forgeSchemaSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "forge",
+		Name:      "input_schema_bytes",
+		Help:      "Size of the JSON Schemas sent to forge.",
+		Buckets:   prometheus.ExponentialBuckets(512, 2, 10),
+	})
+
+	clientLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kubernetes_client",
+		Name:      "request_duration_seconds",
+		Help:      "Kubernetes API server request latencies by verb and host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"verb", "host"})
+
+	clientResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kubernetes_client",
+		Name:      "requests_total",
+		Help:      "Number of Kubernetes API server requests by status code, method and host.",
+	}, []string{"code", "method", "host"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		forgeDuration,
+		forgeOutcomes,
+		forgeSchemaSize,
+		clientLatency,
+		clientResults,
+	)
+
+	clientmetrics.Register(clientmetrics.RegisterOpts{
+		RequestLatency: latencyAdapter{},
+		RequestResult:  resultAdapter{},
+	})
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Instrument counts and times the requests served by next, labelling them with route.
+func Instrument(route string, next http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+
+	return promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), next))
+}
+
+// ObserveForgeStage records the duration of a forge pipeline stage started at start.
+func ObserveForgeStage(stage string, start time.Time) {
+	forgeDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// ForgeOutcome counts a forge request by outcome.
+func ForgeOutcome(outcome string) {
+	forgeOutcomes.WithLabelValues(outcome).Inc()
+}
+
+// ObserveForgeSchemaSize records the size in bytes of a forge input schema.
+func ObserveForgeSchemaSize(size int) {
+	forgeSchemaSize.Observe(float64(size))
+}
+
+type latencyAdapter struct{}
+
+func (latencyAdapter) Observe(_ context.Context, verb string, u url.URL, latency time.Duration) {
+	clientLatency.WithLabelValues(verb, u.Host).Observe(latency.Seconds())
+}
+
+type resultAdapter struct{}
+
+func (resultAdapter) Increment(_ context.Context, code, method, host string) {
+	clientResults.WithLabelValues(code, method, host).Inc()
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	h := Instrument("/test", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for range 3 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+	}
+
+	assert.Equal(t, float64(3),
+		testutil.ToFloat64(httpRequests.WithLabelValues("/test", "get", "418")))
+}
+
+func TestForge(t *testing.T) {
+	ForgeOutcome(OutcomeTimeout)
+	ObserveForgeStage(StageGenerate, time.Now())
+	ObserveForgeSchemaSize(2048)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(forgeOutcomes.WithLabelValues(OutcomeTimeout)))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	for _, name := range []string{
+		"smithery_forge_requests_total",
+		"smithery_forge_stage_duration_seconds",
+		"smithery_forge_input_schema_bytes",
+		"go_goroutines",
+	} {
+		assert.True(t, strings.Contains(rec.Body.String(), name), name)
+	}
+}
@@ -0,0 +1,120 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/krateoplatformops/smithery/internal/access"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var errNoConfig = errors.New("in cluster config not available")
+
+// Check is a single named readiness check.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// APIServer checks that the API server is reachable.
+func APIServer(rc *rest.Config) Check {
+	return Check{
+		Name: "apiserver",
+		Run: func(ctx context.Context) error {
+			if rc == nil {
+				return errNoConfig
+			}
+
+			cs, err := kubernetes.NewForConfig(rc)
+			if err != nil {
+				return err
+			}
+
+			_, err = cs.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+			return err
+		},
+	}
+}
+
+// APIExtensions checks that the custom resource definitions can be listed.
+func APIExtensions(rc *rest.Config) Check {
+	return Check{
+		Name: "apiextensions",
+		Run: func(ctx context.Context) error {
+			if rc == nil {
+				return errNoConfig
+			}
+
+			dc, err := dynamic.NewForConfig(rc)
+			if err != nil {
+				return err
+			}
+
+			_, err = dc.Resource(schema.GroupVersionResource{
+				Group:    "apiextensions.k8s.io",
+				Version:  "v1",
+				Resource: "customresourcedefinitions",
+			}).List(ctx, metav1.ListOptions{Limit: 1})
+			return err
+		},
+	}
+}
+
+// AuthnNamespace checks that the namespace of the authn clientconfig
+// secrets is configured, exists and its secrets can be read.
+func AuthnNamespace(rc *rest.Config, ns string) Check {
+	return Check{
+		Name: "authn-namespace",
+		Run: func(ctx context.Context) error {
+			if len(ns) == 0 {
+				return errors.New("authn namespace not configured")
+			}
+			if rc == nil {
+				return errNoConfig
+			}
+
+			cs, err := kubernetes.NewForConfig(rc)
+			if err != nil {
+				return err
+			}
+
+			if _, err := cs.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{}); err != nil {
+				return err
+			}
+
+			attrs := authorizationv1.ResourceAttributes{
+				Verb:      "get",
+				Resource:  "secrets",
+				Namespace: ns,
+			}
+			res, err := access.Review(ctx, rc, attrs)
+			if err != nil {
+				return err
+			}
+			if !res.Allowed {
+				return fmt.Errorf("service account cannot %s", access.Describe(attrs))
+			}
+
+			return nil
+		},
+	}
+}
+
+// SigningKey checks that the JWT signing key is configured.
+func SigningKey(key string) Check {
+	return Check{
+		Name: "signing-key",
+		Run: func(context.Context) error {
+			if len(key) == 0 {
+				return errors.New("JWT signing key not configured")
+			}
+			return nil
+		},
+	}
+}
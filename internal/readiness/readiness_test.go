@@ -0,0 +1,44 @@
+package readiness
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+func TestAPIServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major":"1","minor":"33"}`))
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, APIServer(&rest.Config{Host: srv.URL}).Run(context.Background()))
+
+	srv.Close()
+	assert.Error(t, APIServer(&rest.Config{Host: srv.URL}).Run(context.Background()))
+}
+
+func TestMissingConfiguration(t *testing.T) {
+	ctx := context.Background()
+
+	for _, chk := range []Check{
+		APIServer(nil),
+		APIExtensions(nil),
+		AuthnNamespace(nil, "demo-system"),
+		AuthnNamespace(&rest.Config{}, ""),
+		SigningKey(""),
+	} {
+		assert.Error(t, chk.Run(ctx), chk.Name)
+	}
+
+	assert.NoError(t, SigningKey("AbbraCadabbra").Run(ctx))
+}
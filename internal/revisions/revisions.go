@@ -0,0 +1,268 @@
+package revisions
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/kubeutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	LabelSchema   = "smithery.krateo.io/schema"
+	LabelGroup    = "smithery.krateo.io/group"
+	LabelKind     = "smithery.krateo.io/kind"
+	LabelVersion  = "smithery.krateo.io/version"
+	LabelRevision = "smithery.krateo.io/revision"
+
+	// AnnotationRevision, set on the forged CRDs, is the number of the input schema revision.
+	AnnotationRevision = "smithery.krateo.io/schema-revision"
+	// AnnotationConfigMap, set on the forged CRDs, is the 'namespace/name' of the
+	// ConfigMap holding the input schema revision.
+	AnnotationConfigMap = "smithery.krateo.io/schema-configmap"
+
+	annotationUser = "smithery.krateo.io/user"
+	annotationHash = "smithery.krateo.io/schema-hash"
+	annotationTime = "smithery.krateo.io/created"
+
+	schemaKey = "schema.json"
+)
+
+// Revision describes a stored forge input schema.
+type Revision struct {
+	Number     int       `json:"revision"`
+	Group      string    `json:"group"`
+	Kind       string    `json:"kind"`
+	Version    string    `json:"version"`
+	ConfigMap  string    `json:"configMap"`
+	SchemaHash string    `json:"schemaHash"`
+	User       string    `json:"user,omitempty"`
+	Time       time.Time `json:"time"`
+
+	// created is true when the revision has just been created by Save.
+	created bool
+}
+
+// Annotations returns the annotations referencing the revision from a CRD.
+func (r *Revision) Annotations() map[string]string {
+	return map[string]string{
+		AnnotationRevision:  strconv.Itoa(r.Number),
+		AnnotationConfigMap: r.ConfigMap,
+	}
+}
+
+// Store keeps the forge input schemas as immutable ConfigMaps in its namespace,
+// one for each revision, labelled with group, kind, version and revision number.
+type Store struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func NewStore(rc *rest.Config, namespace string) (*Store, error) {
+	cs, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStore(cs, namespace), nil
+}
+
+func newStore(cs kubernetes.Interface, namespace string) *Store {
+	return &Store{
+		client:    cs,
+		namespace: namespace,
+	}
+}
+
+// maxSaveAttempts bounds the retries of Save when concurrent forges
+// of the same widget reserve the same revision number.
+const maxSaveAttempts = 10
+
+// Save stores the schema (identified by rev.SchemaHash) as the next revision of
+// the widget and returns it; when the latest revision holds the same schema and
+// version, it is returned instead.
+// The ConfigMap names are derived from the revision numbers, so that concurrent
+// saves never share a number: the one losing the race retries with the next one.
+func (s *Store) Save(ctx context.Context, rev Revision, data []byte) (Revision, error) {
+	if rev.Time.IsZero() {
+		rev.Time = time.Now().UTC()
+	}
+
+	for attempt := 1; ; attempt++ {
+		all, err := s.List(ctx, rev.Group, rev.Kind)
+		if err != nil {
+			return Revision{}, err
+		}
+
+		rev.Number = 1
+		if n := len(all); n > 0 {
+			last := all[n-1]
+			if last.SchemaHash == rev.SchemaHash && last.Version == rev.Version {
+				return last, nil
+			}
+			rev.Number = last.Number + 1
+		}
+
+		err = s.create(ctx, &rev, data)
+		if err == nil {
+			return rev, nil
+		}
+		if !apierrors.IsAlreadyExists(err) || attempt >= maxSaveAttempts {
+			return Revision{}, fmt.Errorf("unable to store schema revision %d of %s: %w", rev.Number, rev.Kind, err)
+		}
+	}
+}
+
+// Delete removes a revision just created by Save, i.e. when the CRD
+// referencing it could not be applied. The other revisions are kept.
+func (s *Store) Delete(ctx context.Context, rev Revision) error {
+	if !rev.created {
+		return nil
+	}
+
+	_, name, _ := strings.Cut(rev.ConfigMap, "/")
+
+	err := s.client.CoreV1().ConfigMaps(s.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete schema revision %d of %s: %w", rev.Number, rev.Kind, err)
+	}
+
+	return nil
+}
+
+// create stores the revision in the ConfigMap named after its number.
+func (s *Store) create(ctx context.Context, rev *Revision, data []byte) error {
+	name := configMapName(rev.Group, rev.Kind, rev.Number)
+
+	_, err := s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				LabelSchema:   "true",
+				LabelGroup:    rev.Group,
+				LabelKind:     rev.Kind,
+				LabelVersion:  rev.Version,
+				LabelRevision: strconv.Itoa(rev.Number),
+			},
+			Annotations: map[string]string{
+				annotationUser: rev.User,
+				annotationHash: rev.SchemaHash,
+				annotationTime: rev.Time.Format(time.RFC3339),
+			},
+		},
+		Immutable: ptr.To(true),
+		Data: map[string]string{
+			schemaKey: string(data),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	rev.ConfigMap = s.namespace + "/" + name
+	rev.created = true
+	return nil
+}
+
+// configMapName returns the name of the ConfigMap of a revision: the group
+// is hashed, since kinds with the same name may live in different groups.
+func configMapName(group, kind string, number int) string {
+	h := fnv.New32a()
+	h.Write([]byte(group))
+
+	return fmt.Sprintf("smithery-schema-%s-%08x-r%d",
+		kubeutil.MakeDNS1123Compatible(kind), h.Sum32(), number)
+}
+
+// List returns the schema revisions of a widget, oldest first.
+func (s *Store) List(ctx context.Context, group, kind string) ([]Revision, error) {
+	all, err := s.list(ctx, labels.Set{
+		LabelSchema: "true",
+		LabelGroup:  group,
+		LabelKind:   kind,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Revision, 0, len(all))
+	for _, el := range all {
+		rev, err := fromConfigMap(&el)
+		if err != nil {
+			continue
+		}
+		res = append(res, rev)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Number < res[j].Number
+	})
+
+	return res, nil
+}
+
+// Get returns a schema revision of a widget and the schema itself.
+// When the revision does not exist a NotFound *StatusError is returned.
+func (s *Store) Get(ctx context.Context, group, kind string, number int) (Revision, []byte, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).
+		Get(ctx, configMapName(group, kind, number), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return Revision{}, nil, apierrors.NewNotFound(
+			schema.GroupResource{Group: group, Resource: "revisions"},
+			fmt.Sprintf("%s/%d", kind, number))
+	}
+	if err != nil {
+		return Revision{}, nil, err
+	}
+
+	rev, err := fromConfigMap(cm)
+	if err != nil {
+		return Revision{}, nil, err
+	}
+
+	return rev, []byte(cm.Data[schemaKey]), nil
+}
+
+func (s *Store) list(ctx context.Context, set labels.Set) ([]corev1.ConfigMap, error) {
+	all, err := s.client.CoreV1().ConfigMaps(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(set).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return all.Items, nil
+}
+
+func fromConfigMap(cm *corev1.ConfigMap) (Revision, error) {
+	num, err := strconv.Atoi(cm.Labels[LabelRevision])
+	if err != nil {
+		return Revision{}, fmt.Errorf("invalid revision label in ConfigMap %q: %w", cm.Name, err)
+	}
+
+	ts, _ := time.Parse(time.RFC3339, cm.Annotations[annotationTime])
+
+	return Revision{
+		Number:     num,
+		Group:      cm.Labels[LabelGroup],
+		Kind:       cm.Labels[LabelKind],
+		Version:    cm.Labels[LabelVersion],
+		ConfigMap:  cm.Namespace + "/" + cm.Name,
+		SchemaHash: cm.Annotations[annotationHash],
+		User:       cm.Annotations[annotationUser],
+		Time:       ts,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package revisions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(fake.NewClientset(), "demo-system")
+
+	const group = "widgets.templates.krateo.io"
+
+	save := func(version, hash, data string) Revision {
+		rev, err := store.Save(ctx, Revision{
+			Group: group, Kind: "Button", Version: version, SchemaHash: hash, User: "cyberjoker",
+		}, []byte(data))
+		require.NoError(t, err)
+		return rev
+	}
+
+	r1 := save("v1beta1", "sha256:a", `{"a":1}`)
+	assert.Equal(t, 1, r1.Number)
+	assert.Equal(t, "1", r1.Annotations()[AnnotationRevision])
+	assert.Equal(t, "demo-system/"+configMapName(group, "Button", 1), r1.Annotations()[AnnotationConfigMap])
+
+	// Same schema and version: no new revision.
+	again := save("v1beta1", "sha256:a", `{"a":1}`)
+	assert.Equal(t, r1.Number, again.Number)
+	assert.Equal(t, r1.ConfigMap, again.ConfigMap)
+
+	r2 := save("v1beta1", "sha256:b", `{"b":2}`)
+	assert.Equal(t, 2, r2.Number)
+
+	r3 := save("v1beta2", "sha256:b", `{"b":2}`)
+	assert.Equal(t, 3, r3.Number)
+
+	all, err := store.List(ctx, group, "Button")
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	for i, el := range all {
+		assert.Equal(t, i+1, el.Number)
+		assert.Equal(t, "cyberjoker", el.User)
+		assert.False(t, el.Time.IsZero())
+	}
+
+	rev, dat, err := store.Get(ctx, group, "Button", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:b", rev.SchemaHash)
+	assert.Equal(t, "v1beta1", rev.Version)
+	assert.JSONEq(t, `{"b":2}`, string(dat))
+
+	_, _, err = store.Get(ctx, group, "Button", 9)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	others, err := store.List(ctx, group, "Panel")
+	require.NoError(t, err)
+	assert.Empty(t, others)
+}
+
+func TestStoreConcurrentSaves(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(fake.NewClientset(), "demo-system")
+
+	const (
+		group = "widgets.templates.krateo.io"
+		count = 5
+	)
+
+	var wg sync.WaitGroup
+	errs := make([]error, count)
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = store.Save(ctx, Revision{
+				Group: group, Kind: "Button", Version: "v1beta1", SchemaHash: fmt.Sprintf("sha256:%d", i),
+			}, []byte(`{}`))
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	all, err := store.List(ctx, group, "Button")
+	require.NoError(t, err)
+	require.Len(t, all, count)
+	for i, el := range all {
+		assert.Equal(t, i+1, el.Number)
+	}
+}
+
+func TestStoreSaveRace(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewClientset()
+	store := newStore(cs, "demo-system")
+
+	const group = "widgets.templates.krateo.io"
+
+	// A concurrent forge stores revision 1 right after this one listed the revisions.
+	raced := false
+	cs.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if raced {
+			return false, nil, nil
+		}
+		raced = true
+
+		other := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap).DeepCopy()
+		other.Annotations[annotationHash] = "sha256:other"
+		return false, nil, cs.Tracker().Add(other)
+	})
+
+	rev, err := store.Save(ctx, Revision{
+		Group: group, Kind: "Button", Version: "v1beta1", SchemaHash: "sha256:mine",
+	}, []byte(`{"mine":true}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, rev.Number)
+
+	got, dat, err := store.Get(ctx, group, "Button", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:mine", got.SchemaHash)
+	assert.JSONEq(t, `{"mine":true}`, string(dat))
+
+	// The revision of a CRD that could not be applied is discarded.
+	require.NoError(t, store.Delete(ctx, rev))
+	_, _, err = store.Get(ctx, group, "Button", 2)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Revisions not created by Save are kept.
+	first, _, err := store.Get(ctx, group, "Button", 1)
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(ctx, first))
+	_, _, err = store.Get(ctx, group, "Button", 1)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+)
+
+const instrumentationName = "github.com/krateoplatformops/smithery"
+
+// Supported span exporters.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+type Options struct {
+	// Exporter is one of 'none', 'otlp' or 'stdout'.
+	Exporter string
+	// Endpoint of the OTLP/HTTP collector, as 'host:port' or URL (i.e. 'http://otel-collector:4318'); when empty
+	// the standard OTEL_EXPORTER_OTLP_* environment variables are honoured.
+	Endpoint       string
+	Insecure       bool
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Setup installs the global W3C trace context propagator and, unless the exporter
+// is 'none', a tracer provider exporting the spans. The returned function flushes
+// and stops the exporter.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exp sdktrace.SpanExporter
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var eo []otlptracehttp.Option
+		switch {
+		case strings.Contains(opts.Endpoint, "://"):
+			eo = append(eo, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		case len(opts.Endpoint) > 0:
+			eo = append(eo, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			eo = append(eo, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(ctx, eo...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, must be one of: %s, %s, %s",
+			opts.Exporter, ExporterNone, ExporterOTLP, ExporterStdout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(opts.ServiceName),
+			semconv.ServiceVersion(opts.ServiceVersion),
+		))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// Start creates a span (and a context holding it) using the global tracer provider.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records err, if any, on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Handler wraps next in a server span named after route, continuing the trace
+// of the incoming W3C traceparent header, if any. When the request does not
+// carry a Krateo trace id, the OpenTelemetry one is used, so logs and spans
+// can be correlated.
+func Handler(route string, next http.Handler) http.Handler {
+	fn := func(wri http.ResponseWriter, req *http.Request) {
+		sc := trace.SpanContextFromContext(req.Context())
+		if sc.HasTraceID() && len(req.Header.Get(xcontext.LabelKrateoTraceId)) == 0 {
+			req.Header.Set(xcontext.LabelKrateoTraceId, sc.TraceID().String())
+		}
+
+		next.ServeHTTP(wri, req)
+	}
+
+	return otelhttp.NewHandler(http.HandlerFunc(fn), route,
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return req.Method + " " + route
+		}))
+}
+
+// WrapConfig makes all the requests sent with rc traced as client spans.
+func WrapConfig(rc *rest.Config) {
+	rc.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt)
+	})
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	xcontext "github.com/krateoplatformops/plumbing/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	for _, exp := range []string{ExporterNone, ExporterStdout, ExporterOTLP} {
+		t.Run(exp, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), Options{
+				Exporter:    exp,
+				Endpoint:    "http://127.0.0.1:4318",
+				ServiceName: "smithery",
+			})
+			require.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+
+	_, err := Setup(context.Background(), Options{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	_, err := Setup(context.Background(), Options{Exporter: ExporterNone})
+	require.NoError(t, err)
+
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var krateoTraceId string
+	h := Handler("/schema", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		krateoTraceId = req.Header.Get(xcontext.LabelKrateoTraceId)
+
+		_, span := Start(req.Context(), "schema.resolve")
+		End(span, nil)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/schema", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, traceID, krateoTraceId)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "schema.resolve", spans[0].Name())
+	assert.Equal(t, "GET /schema", spans[1].Name())
+	for _, el := range spans {
+		assert.Equal(t, traceID, el.SpanContext().TraceID().String())
+	}
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
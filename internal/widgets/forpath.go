@@ -0,0 +1,193 @@
+package widgets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/krateoplatformops/plumbing/jqutil"
+	"github.com/krateoplatformops/smithery/internal/crds"
+)
+
+// Types of the forPath targets, besides the OpenAPI ones.
+const (
+	// TypeAny is the type of the targets accepting any value.
+	TypeAny = "any"
+	// TypeIntOrString is the type of the 'x-kubernetes-int-or-string' targets.
+	TypeIntOrString = "int-or-string"
+)
+
+// ForPath is a widgetData property that a widgetDataTemplate can target.
+type ForPath struct {
+	// Path is the dotted path of the property, with '[]' after the arrays
+	// (i.e. 'actions.navigate[].path').
+	Path string `json:"path"`
+	// Type is the OpenAPI type of the property, TypeAny or TypeIntOrString.
+	Type string `json:"type"`
+	// Enum are the allowed values, if any.
+	Enum []any `json:"enum,omitempty"`
+	// FreeForm is true when the property is an object accepting any field.
+	FreeForm bool `json:"freeForm,omitempty"`
+}
+
+// WidgetData returns the widgetData schema of a widget schema,
+// as returned by crds.OpenAPISchema.
+func WidgetData(schema map[string]any) (map[string]any, error) {
+	sub, err := crds.SubSchema(schema, "spec.widgetData")
+	if err != nil {
+		return nil, err
+	}
+
+	wd, ok := sub.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid widgetData schema")
+	}
+	return wd, nil
+}
+
+// ForPaths returns, sorted by path, all the properties of the widgetData
+// schema that a widgetDataTemplate can target.
+func ForPaths(widgetData map[string]any) []ForPath {
+	res := []ForPath{}
+	walkForPaths(widgetData, "", &res)
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res
+}
+
+func walkForPaths(schema map[string]any, prefix string, res *[]ForPath) {
+	props, _ := schema["properties"].(map[string]any)
+	for name, el := range props {
+		sub, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		path := name
+		if len(prefix) > 0 {
+			path = prefix + "." + name
+		}
+
+		*res = append(*res, newForPath(path, sub))
+
+		for sub["type"] == "array" {
+			items, ok := sub["items"].(map[string]any)
+			if !ok {
+				break
+			}
+			path, sub = path+"[]", items
+		}
+
+		if sub["type"] == "object" && !freeForm(sub) {
+			walkForPaths(sub, path, res)
+		}
+	}
+}
+
+// LookupForPath returns the widgetData property targeted by a forPath,
+// a dotted path with optional array indices (i.e. 'items[0].name').
+// Properties of free-form objects have TypeAny.
+func LookupForPath(widgetData map[string]any, forPath string) (ForPath, error) {
+	path := indexRE.ReplaceAllString(strings.TrimSpace(forPath), "")
+	path = strings.TrimPrefix(path, ".")
+
+	cur := widgetData
+	for _, name := range strings.Split(path, ".") {
+		if len(name) == 0 {
+			return ForPath{}, fmt.Errorf("empty segment in path")
+		}
+
+		for cur["type"] == "array" {
+			items, ok := cur["items"].(map[string]any)
+			if !ok {
+				return ForPath{Path: forPath, Type: TypeAny}, nil
+			}
+			cur = items
+		}
+
+		if freeForm(cur) {
+			return ForPath{Path: forPath, Type: TypeAny}, nil
+		}
+
+		props, _ := cur["properties"].(map[string]any)
+		next, ok := props[name].(map[string]any)
+		if !ok {
+			return ForPath{}, fmt.Errorf("property %q not found in widgetData", name)
+		}
+		cur = next
+	}
+
+	return newForPath(forPath, cur), nil
+}
+
+// CheckForPath checks that a forPath, a dotted path with optional array
+// indices (i.e. 'items[0].name'), points at a property of the widgetData schema.
+// Properties of free-form objects are accepted as they are.
+func CheckForPath(widgetData map[string]any, forPath string) error {
+	_, err := LookupForPath(widgetData, forPath)
+	return err
+}
+
+// CheckType checks that a value of the specified JSON type (as returned by
+// TypeOf) can be assigned to the forPath target. An empty type, as the one
+// of JQ queries, is not checked.
+func (fp ForPath) CheckType(typ string) error {
+	if len(typ) == 0 || fp.Type == TypeAny || typ == fp.Type {
+		return nil
+	}
+
+	switch {
+	case typ == "integer" && fp.Type == "number":
+		return nil
+	case (typ == "integer" || typ == "string") && fp.Type == TypeIntOrString:
+		return nil
+	}
+
+	return fmt.Errorf("%s value does not match the %s type of %q", typ, fp.Type, fp.Path)
+}
+
+// TypeOf returns the JSON type of the value of a widgetDataTemplate expression.
+// It is empty for JQ queries, whose result is known only at runtime.
+func TypeOf(expr string) string {
+	if _, ok := jqutil.MaybeQuery(expr); ok || strings.Contains(expr, "${") {
+		return ""
+	}
+
+	switch v := jqutil.InferType(expr).(type) {
+	case nil:
+		return ""
+	case bool:
+		return "boolean"
+	case int32, int64:
+		return "integer"
+	case float64:
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func newForPath(path string, schema map[string]any) ForPath {
+	res := ForPath{Path: path, Type: TypeAny}
+
+	if typ, ok := schema["type"].(string); ok {
+		res.Type = typ
+	}
+	if v, _ := schema["x-kubernetes-int-or-string"].(bool); v {
+		res.Type = TypeIntOrString
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		res.Enum = enum
+	}
+	res.FreeForm = res.Type == "object" && freeForm(schema)
+
+	return res
+}
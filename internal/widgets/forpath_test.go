@@ -0,0 +1,66 @@
+package widgets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForPaths(t *testing.T) {
+	wd, err := WidgetData(buttonSchema())
+	require.NoError(t, err)
+
+	assert.Equal(t, []ForPath{
+		{Path: "extra", Type: "object", FreeForm: true},
+		{Path: "items", Type: "array"},
+		{Path: "items[].name", Type: "string"},
+		{Path: "label", Type: "string"},
+	}, ForPaths(wd))
+
+	_, err = WidgetData(map[string]any{"type": "object"})
+	assert.Error(t, err)
+}
+
+func TestLookupForPath(t *testing.T) {
+	wd, err := WidgetData(buttonSchema())
+	require.NoError(t, err)
+
+	got, err := LookupForPath(wd, "items[2].name")
+	require.NoError(t, err)
+	assert.Equal(t, ForPath{Path: "items[2].name", Type: "string"}, got)
+
+	got, err = LookupForPath(wd, "extra.whatever")
+	require.NoError(t, err)
+	assert.Equal(t, TypeAny, got.Type)
+
+	_, err = LookupForPath(wd, "items[0].surname")
+	assert.EqualError(t, err, `property "surname" not found in widgetData`)
+}
+
+func TestCheckType(t *testing.T) {
+	tests := []struct {
+		target ForPath
+		expr   string
+		err    string
+	}{
+		{target: ForPath{Path: "label", Type: "string"}, expr: "Click me"},
+		{target: ForPath{Path: "label", Type: "string"}, expr: "${ .name }"},
+		{target: ForPath{Path: "size", Type: "number"}, expr: "42"},
+		{target: ForPath{Path: "port", Type: TypeIntOrString}, expr: "8080"},
+		{target: ForPath{Path: "extra", Type: TypeAny}, expr: "true"},
+		{target: ForPath{Path: "label", Type: "string"}, expr: "true", err: `boolean value does not match the string type of "label"`},
+		{target: ForPath{Path: "items", Type: "array"}, expr: `{"a": 1}`, err: `object value does not match the array type of "items"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			err := tc.target.CheckType(TypeOf(tc.expr))
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/krateoplatformops/plumbing/jqutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var indexRE = regexp.MustCompile(`\[[^\]]*\]`)
+
+// Validate checks the Krateo semantics of a widget that its OpenAPI schema
+// (the openAPIV3Schema of the widget CRD version) cannot express:
+//   - every widgetDataTemplate[].forPath points at a widgetData property
+//   - every literal widgetDataTemplate[].expression matches the type of its forPath
+//   - every widgetDataTemplate[].expression is a valid JQ query
+//   - every resourcesRefsTemplate[] iterator and template value is a valid JQ query
+//   - every resourcesRefs.items[].id is unique
+func Validate(obj map[string]any, schema map[string]any) field.ErrorList {
+	spec := field.NewPath("spec")
+
+	var errs field.ErrorList
+
+	wd, _ := WidgetData(schema)
+
+	templates, _, _ := unstructured.NestedSlice(obj, "spec", "widgetDataTemplate")
+	for i, el := range templates {
+		fld := spec.Child("widgetDataTemplate").Index(i)
+
+		tpl, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		forPath, _ := tpl["forPath"].(string)
+		switch {
+		case len(forPath) == 0:
+			errs = append(errs, field.Required(fld.Child("forPath"), "must point at a widgetData property"))
+		case wd == nil:
+			errs = append(errs, field.Invalid(fld.Child("forPath"), forPath, "the widget schema has no widgetData"))
+		default:
+			target, err := LookupForPath(wd, forPath)
+			if err != nil {
+				errs = append(errs, field.Invalid(fld.Child("forPath"), forPath, err.Error()))
+				break
+			}
+
+			if expr, ok := tpl["expression"].(string); ok {
+				if err := target.CheckType(TypeOf(expr)); err != nil {
+					errs = append(errs, field.Invalid(fld.Child("expression"), expr, err.Error()))
+				}
+			}
+		}
+
+		expr, _ := tpl["expression"].(string)
+		if err := CheckExpression(expr); err != nil {
+			errs = append(errs, field.Invalid(fld.Child("expression"), expr, err.Error()))
+		}
+	}
+
+	refsTemplates, _, _ := unstructured.NestedSlice(obj, "spec", "resourcesRefsTemplate")
+	for i, el := range refsTemplates {
+		fld := spec.Child("resourcesRefsTemplate").Index(i)
+
+		tpl, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if it, ok := tpl["iterator"].(string); ok {
+			if err := CheckExpression(it); err != nil {
+				errs = append(errs, field.Invalid(fld.Child("iterator"), it, err.Error()))
+			}
+		}
+
+		errs = append(errs, checkExpressions(fld.Child("template"), tpl["template"])...)
+	}
+
+	items, _, _ := unstructured.NestedSlice(obj, "spec", "resourcesRefs", "items")
+	seen := map[string]bool{}
+	for i, el := range items {
+		ref, ok := el.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		id, _ := ref["id"].(string)
+		if len(id) == 0 {
+			continue
+		}
+		if seen[id] {
+			errs = append(errs, field.Duplicate(spec.Child("resourcesRefs", "items").Index(i).Child("id"), id))
+		}
+		seen[id] = true
+	}
+
+	return errs
+}
+
+// CheckExpression checks the JQ query of an expression, if any: expressions
+// without '${...}' are literal values. The query is compiled too, so that
+// unknown functions and variables are reported; queries importing modules
+// are only parsed since their functions are known at runtime.
+func CheckExpression(expr string) error {
+	query, ok := jqutil.MaybeQuery(expr)
+	if !ok {
+		if strings.Contains(expr, "${") {
+			return fmt.Errorf("unterminated '${' in expression")
+		}
+		return nil
+	}
+
+	parsed, err := gojq.Parse(query)
+	if err != nil {
+		var perr *gojq.ParseError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("invalid JQ query: %w (at offset %d)", err, perr.Offset)
+		}
+		return fmt.Errorf("invalid JQ query: %w", err)
+	}
+
+	if len(parsed.Imports) > 0 {
+		return nil
+	}
+
+	if _, err := gojq.Compile(parsed); err != nil {
+		return fmt.Errorf("invalid JQ query: %w", err)
+	}
+
+	return nil
+}
+
+// checkExpressions checks the JQ queries of all the string values of a
+// (possibly nested) template.
+func checkExpressions(fld *field.Path, v any) field.ErrorList {
+	var errs field.ErrorList
+
+	switch val := v.(type) {
+	case string:
+		if err := CheckExpression(val); err != nil {
+			errs = append(errs, field.Invalid(fld, val, err.Error()))
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			errs = append(errs, checkExpressions(fld.Child(k), val[k])...)
+		}
+	case []any:
+		for i, el := range val {
+			errs = append(errs, checkExpressions(fld.Index(i), el)...)
+		}
+	}
+
+	return errs
+}
+
+// freeForm reports whether any property is allowed in an object schema.
+// Objects declaring their properties are not free-form, even when they
+// preserve the unknown fields (as the forged widgetData does).
+func freeForm(schema map[string]any) bool {
+	switch ap := schema["additionalProperties"].(type) {
+	case bool:
+		if ap {
+			return true
+		}
+	case map[string]any:
+		return true
+	}
+
+	if _, hasProps := schema["properties"]; hasProps {
+		return false
+	}
+
+	if v, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool); v {
+		return true
+	}
+
+	return schema["type"] == "object"
+}
@@ -0,0 +1,135 @@
+package widgets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func buttonSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"spec": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"widgetData": map[string]any{
+						"type":                                 "object",
+						"x-kubernetes-preserve-unknown-fields": true,
+						"properties": map[string]any{
+							"label": map[string]any{"type": "string"},
+							"items": map[string]any{
+								"type": "array",
+								"items": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"name": map[string]any{"type": "string"},
+									},
+								},
+							},
+							"extra": map[string]any{
+								"type":                                 "object",
+								"x-kubernetes-preserve-unknown-fields": true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCheckForPath(t *testing.T) {
+	wd := buttonSchema()["properties"].(map[string]any)["spec"].(map[string]any)["properties"].(map[string]any)["widgetData"].(map[string]any)
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{path: "label"},
+		{path: ".label"},
+		{path: "items"},
+		{path: "items[0].name"},
+		{path: "items.name"},
+		{path: "extra.whatever.deep"},
+		{path: "missing", err: `property "missing" not found in widgetData`},
+		{path: "items[0].surname", err: `property "surname" not found in widgetData`},
+		{path: "label..x", err: "empty segment in path"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			err := CheckForPath(wd, tc.path)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	assert.NoError(t, CheckExpression("a literal value"))
+	assert.NoError(t, CheckExpression("${ .items | map(.name) }"))
+	assert.ErrorContains(t, CheckExpression("${ .items | map(.name }"), "invalid JQ query")
+	assert.ErrorContains(t, CheckExpression("${ .name"), "unterminated")
+	assert.ErrorContains(t, CheckExpression("${ .items | mapp(.name) }"), "function not defined: mapp/1")
+	assert.ErrorContains(t, CheckExpression("${ .items | map($name) }"), "variable not defined: $name")
+	assert.ErrorContains(t, CheckExpression("${ .a | }"), "at offset")
+	assert.NoError(t, CheckExpression(`${ import "utils" as u; .items | u::names }`))
+}
+
+func TestValidate(t *testing.T) {
+	obj := map[string]any{
+		"spec": map[string]any{
+			"widgetDataTemplate": []any{
+				map[string]any{"forPath": "label", "expression": "${ .name }"},
+				map[string]any{"forPath": "color", "expression": "${ .color"},
+				map[string]any{"expression": "${ .x }"},
+				map[string]any{"forPath": "label", "expression": "true"},
+			},
+			"resourcesRefsTemplate": []any{
+				map[string]any{
+					"iterator": "${ .items }",
+					"template": map[string]any{
+						"id":      "${ .id }",
+						"name":    "${ .name | ascii_downcas }",
+						"payload": map[string]any{"labels": []any{"${ .label | }"}},
+					},
+				},
+				map[string]any{"iterator": "${ .items[ }"},
+			},
+			"resourcesRefs": map[string]any{
+				"items": []any{
+					map[string]any{"id": "a"},
+					map[string]any{"id": "b"},
+					map[string]any{"id": "a"},
+				},
+			},
+		},
+	}
+
+	errs := Validate(obj, buttonSchema())
+	require.Len(t, errs, 8)
+
+	got := map[string]field.ErrorType{}
+	for _, el := range errs {
+		got[el.Field] = el.Type
+	}
+	assert.Equal(t, map[string]field.ErrorType{
+		"spec.widgetDataTemplate[1].forPath":    field.ErrorTypeInvalid,
+		"spec.widgetDataTemplate[1].expression": field.ErrorTypeInvalid,
+		"spec.widgetDataTemplate[2].forPath":    field.ErrorTypeRequired,
+		"spec.widgetDataTemplate[3].expression": field.ErrorTypeInvalid,
+		"spec.resourcesRefs.items[2].id":        field.ErrorTypeDuplicate,
+
+		"spec.resourcesRefsTemplate[0].template.name":              field.ErrorTypeInvalid,
+		"spec.resourcesRefsTemplate[0].template.payload.labels[0]": field.ErrorTypeInvalid,
+		"spec.resourcesRefsTemplate[1].iterator":                   field.ErrorTypeInvalid,
+	}, got)
+
+	assert.Empty(t, Validate(map[string]any{"spec": map[string]any{}}, buttonSchema()))
+}
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,9 +20,21 @@ import (
 	"github.com/krateoplatformops/plumbing/server/use/cors"
 	"github.com/krateoplatformops/plumbing/slogs/pretty"
 	_ "github.com/krateoplatformops/smithery/docs"
+	"github.com/krateoplatformops/smithery/internal/audit"
+	"github.com/krateoplatformops/smithery/internal/cli"
+	"github.com/krateoplatformops/smithery/internal/controller"
+	"github.com/krateoplatformops/smithery/internal/crds"
+	"github.com/krateoplatformops/smithery/internal/dynamic"
+	forgelib "github.com/krateoplatformops/smithery/internal/forge"
 	"github.com/krateoplatformops/smithery/internal/handlers"
+	"github.com/krateoplatformops/smithery/internal/limits"
+	"github.com/krateoplatformops/smithery/internal/metrics"
+	"github.com/krateoplatformops/smithery/internal/readiness"
+	"github.com/krateoplatformops/smithery/internal/revisions"
+	"github.com/krateoplatformops/smithery/internal/tracing"
 
 	httpSwagger "github.com/swaggo/http-swagger"
+	"k8s.io/client-go/rest"
 )
 
 const (
@@ -40,12 +54,51 @@ var (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 func main() {
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	debugOn := flag.Bool("debug", env.Bool("DEBUG", false), "enable or disable debug logs")
 	blizzardOn := flag.Bool("blizzard", env.Bool("BLIZZARD", false), "dump verbose output")
 	port := flag.Int("port", env.ServicePort("PORT", 8081), "port to listen on")
 	authnNS := flag.String("authn-namespace", env.String("AUTHN_NAMESPACE", ""),
 		"krateo authn service clientconfig secrets namespace")
 	signKey := flag.String("jwt-sign-key", env.String("JWT_SIGN_KEY", ""), "secret key used to sign JWT tokens")
+	crdCacheOn := flag.Bool("crd-cache", env.Bool("CRD_CACHE", true), "serve widget CRDs from an in-memory informer cache")
+	clientTTL := flag.Duration("client-ttl", env.Duration("CLIENT_TTL", dynamic.DefaultPoolTTL),
+		"how long an unused per-user kubernetes client is kept in the pool")
+	clientQPS := flag.Float64("client-qps", env.Float64("CLIENT_QPS", 50), "kubernetes client queries per second")
+	clientBurst := flag.Int("client-burst", env.Int("CLIENT_BURST", 100), "kubernetes client burst")
+	traceExporter := flag.String("trace-exporter", env.String("TRACE_EXPORTER", tracing.ExporterNone),
+		"OpenTelemetry spans exporter: none, otlp or stdout")
+	otlpEndpoint := flag.String("otlp-endpoint", env.String("OTLP_ENDPOINT", ""),
+		"OTLP/HTTP collector endpoint (defaults to the OTEL_EXPORTER_OTLP_* environment variables)")
+	otlpInsecure := flag.Bool("otlp-insecure", env.Bool("OTLP_INSECURE", false), "disable TLS towards the OTLP collector")
+	controllerOn := flag.Bool("controller", env.Bool("CONTROLLER", false),
+		"run the WidgetDefinition controller, forging the CRDs declared as custom resources")
+	controllerWorkers := flag.Int("controller-workers", env.Int("CONTROLLER_WORKERS", 2), "WidgetDefinition controller workers")
+	auditOn := flag.Bool("audit", env.Bool("AUDIT", true), "record the forge audit trail")
+	auditMaxEntries := flag.Int("audit-max-entries", env.Int("AUDIT_MAX_ENTRIES", audit.DefaultMaxEntries),
+		"audit entries kept for each widget kind, the oldest are deleted (0 to keep them all)")
+	metricsPort := flag.Int("metrics-port", env.Int("METRICS_PORT", 0),
+		"port to serve /metrics on (0 to serve them on the main port)")
+	maxBodySize := flag.String("max-body-size", env.String("MAX_BODY_SIZE", "1Mi"),
+		"maximum request body size of every route, as a quantity (0 to disable it)")
+	bodySizes := flag.String("body-sizes", env.String("BODY_SIZES", ""),
+		"comma separated per route body sizes overriding max-body-size (i.e. /forge=512Ki)")
+	maxSchemaDepth := flag.Int("max-schema-depth", env.Int("MAX_SCHEMA_DEPTH", 32),
+		"maximum nesting of the forged JSON Schemas (0 to disable it)")
+	maxSchemaProps := flag.Int("max-schema-properties", env.Int("MAX_SCHEMA_PROPERTIES", 2000),
+		"maximum number of properties of the forged JSON Schemas (0 to disable it)")
+	rateLimit := flag.Float64("rate-limit", env.Float64("RATE_LIMIT", 10),
+		"requests per second allowed to each user (0 to disable the rate limiter)")
+	rateBurst := flag.Int("rate-burst", env.Int("RATE_BURST", 20), "requests burst allowed to each user")
+	rateLimitRoutes := flag.String("rate-limit-routes", env.String("RATE_LIMIT_ROUTES", "/forge,/revisions/rollback"),
+		"comma separated routes protected by the rate limiter")
+	webhookPort := flag.Int("webhook-port", env.Int("WEBHOOK_PORT", 0),
+		"port to serve the widgets validating webhook on, over TLS (0 to disable it)")
+	webhookCertDir := flag.String("webhook-cert-dir", env.String("WEBHOOK_CERT_DIR", "/etc/smithery/webhook"),
+		"directory with the tls.crt and tls.key of the widgets validating webhook")
 
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), "Flags:")
@@ -78,6 +131,124 @@ func main() {
 		log.Debug("environment variables", slog.Any("env", os.Environ()))
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), []os.Signal{
+		os.Interrupt,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGKILL,
+		syscall.SIGHUP,
+		syscall.SIGQUIT,
+	}...)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:       *traceExporter,
+		Endpoint:       *otlpEndpoint,
+		Insecure:       *otlpInsecure,
+		ServiceName:    serviceName,
+		ServiceVersion: build,
+	})
+	if err != nil {
+		log.Error("unable to setup tracing", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	sarc, err := rest.InClusterConfig()
+	if err != nil {
+		log.Warn("unable to create in cluster config, API discovery will not be shared",
+			slog.Any("err", err))
+	}
+
+	pool, err := dynamic.NewPool(dynamic.PoolOptions{
+		TTL:             *clientTTL,
+		QPS:             float32(*clientQPS),
+		Burst:           *clientBurst,
+		DiscoveryConfig: sarc,
+	})
+	if err != nil {
+		log.Error("unable to create kubernetes clients pool", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	var store *crds.Cache
+	if *crdCacheOn && sarc != nil {
+		store, err = crds.NewCache(sarc, handlers.WidgetsGroup)
+		if err != nil {
+			log.Error("unable to create CRDs cache, falling back to API server calls", slog.Any("err", err))
+		} else {
+			go func() {
+				if err := store.Start(ctx); err != nil {
+					log.Error("CRDs cache not started", slog.Any("err", err))
+					return
+				}
+				log.Info("CRDs cache synced", slog.String("group", handlers.WidgetsGroup))
+			}()
+		}
+	}
+
+	var (
+		auditor *audit.Recorder
+		history *revisions.Store
+	)
+	if sarc != nil {
+		ns, err := kubeutil.ServiceAccountNamespace()
+		if err != nil {
+			log.Error("unable to get service account namespace, audit trail and schema revisions disabled",
+				slog.Any("err", err))
+		} else {
+			if *auditOn {
+				auditor, err = audit.NewRecorder(ctx, sarc, ns, *auditMaxEntries)
+				if err != nil {
+					log.Error("unable to create forge audit recorder, audit trail disabled", slog.Any("err", err))
+					auditor = nil
+				}
+			}
+
+			history, err = revisions.NewStore(sarc, ns)
+			if err != nil {
+				log.Error("unable to create schema revisions store, schema revisions disabled", slog.Any("err", err))
+				history = nil
+			}
+		}
+	}
+
+	if *controllerOn {
+		if sarc == nil {
+			log.Error("the WidgetDefinition controller needs the in cluster config")
+			os.Exit(1)
+		}
+
+		ctrl, err := controller.New(sarc, handlers.WidgetsGroup, log)
+		if err != nil {
+			log.Error("unable to create WidgetDefinition controller", slog.Any("err", err))
+			os.Exit(1)
+		}
+
+		go func() {
+			if err := ctrl.Run(ctx, *controllerWorkers); err != nil {
+				log.Error("WidgetDefinition controller cannot run", slog.Any("err", err))
+			}
+		}()
+	}
+
+	defaultBodySize, err := limits.ParseSize(*maxBodySize)
+	if err != nil {
+		log.Error("invalid max body size", slog.String("value", *maxBodySize), slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	routeBodySizes, err := limits.ParseBodySizes(*bodySizes)
+	if err != nil {
+		log.Error("invalid per route body sizes", slog.String("value", *bodySizes), slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	limiter := limits.NewRateLimiter(limits.RateOptions{
+		Rate:  *rateLimit,
+		Burst: *rateBurst,
+	})
+	limitedRoutes := limits.ParseRoutes(*rateLimitRoutes)
+
 	chain := use.NewChain(
 		use.TraceId(),
 		use.Logger(log),
@@ -89,20 +260,96 @@ func main() {
 
 	mux.Handle("GET /swagger/", httpSwagger.WrapHandler)
 	mux.Handle("GET /health", handlers.HealthCheck(serviceName, build, kubeutil.ServiceAccountNamespace))
+	mux.Handle("GET /readyz", handlers.Readyz(
+		readiness.APIServer(sarc),
+		readiness.APIExtensions(sarc),
+		readiness.AuthnNamespace(sarc, *authnNS),
+		readiness.SigningKey(*signKey),
+	))
 
-	mux.Handle("POST /forge", chain.Extend(ext).Then(handlers.Forge()))
-	mux.Handle("GET /schema", chain.Extend(ext).Then(handlers.Schema()))
-	mux.Handle("GET /list", chain.Extend(ext).Then(handlers.List()))
+	// handle serves an authenticated route, measured, traced, with a limited
+	// body size and, when listed in rate-limit-routes, rate limited by user.
+	handle := func(pattern string, h http.Handler) {
+		_, route, _ := strings.Cut(pattern, " ")
 
-	ctx, stop := signal.NotifyContext(context.Background(), []os.Signal{
-		os.Interrupt,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGKILL,
-		syscall.SIGHUP,
-		syscall.SIGQUIT,
-	}...)
-	defer stop()
+		size, ok := routeBodySizes[route]
+		if !ok {
+			size = defaultBodySize
+		}
+
+		routeChain := chain.Extend(ext)
+		if limitedRoutes[route] {
+			routeChain = routeChain.Append(limiter.Handler)
+		}
+
+		mux.Handle(pattern, metrics.Instrument(route,
+			tracing.Handler(route, limits.BodySize(size)(routeChain.Then(h)))))
+	}
+
+	forge := handlers.Forge(pool, auditor, history, forgelib.Limits{
+		MaxDepth:      *maxSchemaDepth,
+		MaxProperties: *maxSchemaProps,
+	})
+
+	handle("POST /forge", forge)
+	handle("GET /schema", handlers.Schema(pool, store))
+	handle("GET /list", handlers.List(pool, store))
+	handle("GET /forpaths", handlers.ForPaths(pool, store))
+	handle("POST /allowedresources/refresh", handlers.RefreshAllowedResources(pool, store))
+	handle("GET /watch", handlers.Watch(pool))
+	handle("GET /audit", handlers.Audit(pool, auditor))
+	handle("GET /revisions", handlers.Revisions(pool, history))
+	handle("POST /revisions/rollback", handlers.Rollback(pool, history, forge))
+
+	var metricsServer *http.Server
+	if *metricsPort == 0 || *metricsPort == *port {
+		mux.Handle("GET /metrics", metrics.Handler())
+	} else {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+
+		metricsServer = &http.Server{
+			Addr:         fmt.Sprintf(":%d", *metricsPort),
+			Handler:      metricsMux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("metrics server cannot run",
+					slog.String("addr", metricsServer.Addr),
+					slog.Any("err", err))
+			}
+		}()
+	}
+
+	var webhookServer *http.Server
+	if *webhookPort > 0 {
+		const route = "/admission/widgets"
+
+		webhookMux := http.NewServeMux()
+		webhookMux.Handle("POST "+route, metrics.Instrument(route,
+			tracing.Handler(route, chain.Then(handlers.Admission(store, sarc)))))
+
+		webhookServer = &http.Server{
+			Addr:         fmt.Sprintf(":%d", *webhookPort),
+			Handler:      webhookMux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			err := webhookServer.ListenAndServeTLS(
+				filepath.Join(*webhookCertDir, "tls.crt"),
+				filepath.Join(*webhookCertDir, "tls.key"))
+			if err != nil && err != http.ErrServerClosed {
+				log.Error("webhook server cannot run",
+					slog.String("addr", webhookServer.Addr),
+					slog.Any("err", err))
+			}
+		}()
+	}
 
 	server := &http.Server{
 		Addr: fmt.Sprintf(":%d", *port),
@@ -113,12 +360,16 @@ func main() {
 				"Accept",
 				"Authorization",
 				"Content-Type",
+				"If-None-Match",
+				"Last-Event-ID",
+				"traceparent",
+				"tracestate",
 				"X-Auth-Code",
 				"X-Krateo-TraceId",
 				"X-Krateo-User",
 				"X-Krateo-Groups",
 			},
-			ExposedHeaders:   []string{"Link"},
+			ExposedHeaders:   []string{"Link", "ETag"},
 			AllowCredentials: true,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		})(mux),
@@ -151,5 +402,21 @@ func main() {
 		log.Error("server forced to shutdown", slog.Any("err", err))
 	}
 
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Error("metrics server forced to shutdown", slog.Any("err", err))
+		}
+	}
+
+	if webhookServer != nil {
+		if err := webhookServer.Shutdown(ctx); err != nil {
+			log.Error("webhook server forced to shutdown", slog.Any("err", err))
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("unable to flush spans", slog.Any("err", err))
+	}
+
 	log.Info("server gracefully stopped")
 }
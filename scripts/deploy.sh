@@ -22,6 +22,7 @@ kind load docker-image ${IMAGE_NAME}:${IMAGE_TAG} --name ${KIND_CLUSTER_NAME}
 
 
 echo "Applying manifests..."
+kubectl apply -f ./manifests/smithery.krateo.io_widgetdefinitions.yaml
 kubectl apply -f "${MANIFEST_PATH}"
 
 echo "Deployment completed."
\ No newline at end of file